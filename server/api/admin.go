@@ -0,0 +1,399 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/sealer"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+type LoginReq struct {
+	// 模型 Id，变体会被忽略
+	Model string `json:"model" validate:"required"`
+	// 账号，为空时使用第一个账号
+	Account string `json:"account,omitempty"`
+}
+
+type Login struct {
+	// 登录会话 Id
+	Id string `json:"id"`
+	// 提供方 Id
+	Model string `json:"model"`
+	// 账号
+	Account string `json:"account"`
+	// 页面当前地址
+	URL string `json:"url"`
+}
+
+type LoginActionReq struct {
+	// 类型，可选 fill、click、press、phone、code
+	// fill：向 selector 对应的输入框填写 text
+	// click：点击 selector 对应的元素，或文本等于 text 的元素，或坐标 x、y
+	// press：按下 text 对应的按键，如 Enter
+	// phone、code：向手机号、验证码输入框填写 text，selector 可覆盖默认的输入框
+	Type string `json:"type" validate:"required"`
+	// playwright 选择器
+	Selector string `json:"selector,omitempty"`
+	// 文本
+	Text string `json:"text,omitempty"`
+	// 横坐标，对应截图中的像素
+	X float64 `json:"x,omitempty"`
+	// 纵坐标，对应截图中的像素
+	Y float64 `json:"y,omitempty"`
+}
+
+func newLogin(ls *browser.LoginSession) *Login {
+	return &Login{Id: ls.Id, Model: ls.Model, Account: ls.Account, URL: ls.URL()}
+}
+
+// Start Login
+//
+//	@router			/admin/logins [post]
+//	@summary		Start Login
+//	@description	Open the login page of the provider in a dedicated tab, the tab is closed after 10 minutes
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@param			*	body		LoginReq	true	"Request"
+//	@success		200	{object}	Login
+func hdrStartLogin(c Ctx) error {
+	req := &LoginReq{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+	ls, err := browser.B().StartLogin(req.Model, req.Account)
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, newLogin(ls))
+}
+
+// Login Screenshot
+//
+//	@router		/admin/logins/{id}/screenshot [get]
+//	@summary	Login Screenshot
+//	@tags		admin
+//	@security	ApiKeyAuth
+//	@produce	jpeg
+//	@param		id	path	string	true	"Login Id"
+//	@success	200
+func hdrLoginScreenshot(c Ctx) error {
+	ls, err := browser.GetLogin(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	bs, err := ls.Screenshot()
+	if err != nil {
+		return err
+	}
+	return c.Blob(200, "image/jpeg", bs)
+}
+
+const mjpegBoundary = "aichat-proxy-frame"
+
+// Login Stream
+//
+//	@router			/admin/logins/{id}/stream [get]
+//	@summary		Login Stream
+//	@description	Live screenshots of the login page as a MJPEG stream, usable as the src of an img
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@produce		multipart/x-mixed-replace
+//	@param			id	path	string	true	"Login Id"
+//	@success		200
+func hdrLoginStream(c Ctx) error {
+	ls, err := browser.GetLogin(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	w := c.Response()
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		bs, err := ls.Screenshot()
+		if err != nil {
+			// the login session is closed
+			logger.Ctx(ctx).Debug().Err(err).Msg("login screenshot error")
+			return nil
+		}
+		_, err = fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(bs))
+		if err == nil {
+			_, err = w.Write(append(bs, '\r', '\n'))
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error().Err(err).Msg("write mjpeg frame error")
+			return nil
+		}
+		w.Flush()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Login QR Code
+//
+//	@router			/admin/logins/{id}/qrcode [get]
+//	@summary		Login QR Code
+//	@description	The QR code to scan for providers like doubao and yuanbao, the login dialog is opened when needed
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@produce		png
+//	@param			id	path	string	true	"Login Id"
+//	@success		200
+func hdrLoginQRCode(c Ctx) error {
+	ls, err := browser.GetLogin(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	bs, err := ls.QRCode()
+	if err != nil {
+		return err
+	}
+	return c.Blob(200, "image/png", bs)
+}
+
+// Login Action
+//
+//	@router			/admin/logins/{id}/actions [post]
+//	@summary		Login Action
+//	@description	Fill the phone number or SMS code, click or press a key in the login page
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@param			id	path		string			true	"Login Id"
+//	@param			*	body		LoginActionReq	true	"Request"
+//	@success		200	{object}	Login
+func hdrLoginAction(c Ctx) error {
+	req := &LoginActionReq{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+	ls, err := browser.GetLogin(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	err = ls.Do(&browser.LoginAction{Type: req.Type, Selector: req.Selector, Text: req.Text, X: req.X, Y: req.Y})
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, newLogin(ls))
+}
+
+// Finish Login
+//
+//	@router			/admin/logins/{id} [delete]
+//	@summary		Finish Login
+//	@description	Close the login tab and check the provider again
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@param			id	path		string	true	"Login Id"
+//	@success		200	{object}	Provider
+func hdrFinishLogin(c Ctx) error {
+	ls, err := browser.GetLogin(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	ls.Close(c.Request().Context())
+	for _, p := range listProviders() {
+		if p.Id == ls.Model {
+			return c.JSON(200, p)
+		}
+	}
+	return c.NoContent(204)
+}
+
+// Export State
+//
+//	@router			/admin/states/{model} [get]
+//	@summary		Export State
+//	@description	Cookies and localStorage of the provider domain in the playwright storage state format, encrypted when a passphrase is configured
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@param			model	path		string	true	"Model Id"
+//	@param			account	query		string	false	"Account, the first one when empty"
+//	@success		200		{object}	object
+func hdrExportState(c Ctx) error {
+	model, account := c.Param("model"), c.QueryParam("account")
+	bs, err := browser.B().ExportState(model, account)
+	if err != nil {
+		return err
+	}
+	if passphrase := config.G().AdminStatePassphrase; passphrase != "" {
+		bs, err = sealer.Seal(bs, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+	filename := config.AppName + "-" + model
+	if account != "" {
+		filename += "-" + account
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+	return c.Blob(200, "application/json", bs)
+}
+
+// Import State
+//
+//	@router			/admin/states/{model} [put]
+//	@summary		Import State
+//	@description	Add the cookies and localStorage of the provider domain from an exported storage state, encrypted or not
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@param			model	path		string	true	"Model Id"
+//	@param			account	query		string	false	"Account, the first one when empty"
+//	@param			*		body		object	true	"Storage State"
+//	@success		200		{object}	Provider
+func hdrImportState(c Ctx) error {
+	model, account := c.Param("model"), c.QueryParam("account")
+	bs, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	if sealer.IsSealed(bs) {
+		passphrase := config.G().AdminStatePassphrase
+		if passphrase == "" {
+			return errx.BadRequest().WithMsgf("storage state is encrypted but no passphrase is configured")
+		}
+		bs, err = sealer.Open(bs, passphrase)
+		if err != nil {
+			return errx.BadRequest().WithMsgf("%v", err)
+		}
+	}
+	if err = browser.B().ImportState(c.Request().Context(), model, account, bs); err != nil {
+		return err
+	}
+	name, _, _ := strings.Cut(model, "/")
+	for _, p := range listProviders() {
+		if p.Id == name {
+			return c.JSON(200, p)
+		}
+	}
+	return c.NoContent(204)
+}
+
+type ListDebugCaptureResp struct {
+	// 固定为 list
+	Object string `json:"object"`
+	// 现场列表，按时间倒序
+	Data []*DebugCapture `json:"data"`
+}
+
+type DebugCapture struct {
+	// 现场 Id，即会话的 handlerId
+	Id string `json:"id"`
+	// 文件列表，可能包含 screenshot.png、page.html、trace.zip、error.txt
+	Files []string `json:"files"`
+	// 总大小，单位字节
+	Size int64 `json:"size"`
+	// 保存时间戳
+	CreatedAt int64 `json:"created_at"`
+}
+
+// Debug Capture List
+//
+//	@router			/admin/debug [get]
+//	@summary		Debug Capture List
+//	@description	Screenshots, html and traces saved when a chat fails to input, send or times out
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@success		200	{object}	ListDebugCaptureResp
+func hdrDebugCaptures(c Ctx) error {
+	captures, err := browser.DebugCaptures()
+	if err != nil {
+		return err
+	}
+	data := make([]*DebugCapture, 0, len(captures))
+	for _, v := range captures {
+		data = append(data, &DebugCapture{Id: v.Id, Files: v.Files, Size: v.Size, CreatedAt: v.Time.Unix()})
+	}
+	return c.JSON(200, &ListDebugCaptureResp{Object: "list", Data: data})
+}
+
+// Debug Capture File
+//
+//	@router			/admin/debug/{id}/{file} [get]
+//	@summary		Debug Capture File
+//	@description	Download a file of a debug capture, open the trace.zip with https://trace.playwright.dev
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@produce		octet-stream
+//	@param			id		path	string	true	"Capture Id"
+//	@param			file	path	string	true	"File Name"
+//	@success		200
+func hdrDebugFile(c Ctx) error {
+	path, err := browser.DebugFile(c.Param("id"), c.Param("file"))
+	if err != nil {
+		return err
+	}
+	return c.Attachment(path, c.Param("id")+"-"+c.Param("file"))
+}
+
+// Selectors
+//
+//	@router			/admin/selectors [get]
+//	@summary		Selectors
+//	@description	The selectors and steps of every handler in use, the built-in ones merged with the override file, which is reloaded when changed
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@success		200	{object}	object
+func hdrSelectors(c Ctx) error {
+	return c.JSON(200, browser.Selectors())
+}
+
+type ListQueueResp struct {
+	// 固定为 list
+	Object string `json:"object"`
+	// 各提供方各账号的队列
+	Data []*Queue `json:"data"`
+}
+
+type Queue struct {
+	// 提供方 Id
+	Id string `json:"id"`
+	// 账号
+	Account string `json:"account"`
+	// 页面数
+	Size int `json:"size"`
+	// 使用中的页面数
+	InUse int `json:"in_use"`
+	// 排队中的请求数
+	Queued int `json:"queued"`
+	// 排队上限，0 表示不限制
+	Limit int `json:"limit"`
+}
+
+// Queue List
+//
+//	@router			/admin/queues [get]
+//	@summary		Queue List
+//	@description	Pages in use and requests waiting for a page of every provider in every account
+//	@tags			admin
+//	@security		ApiKeyAuth
+//	@success		200	{object}	ListQueueResp
+func hdrQueues(c Ctx) error {
+	data := make([]*Queue, 0)
+	for _, v := range browser.B().Queues() {
+		data = append(data, &Queue{Id: v.Name, Account: v.Account, Size: v.Size, InUse: v.InUse, Queued: v.Queued, Limit: v.Limit})
+	}
+	return c.JSON(200, &ListQueueResp{Object: "list", Data: data})
+}
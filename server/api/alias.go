@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// modelRoute is where a requested model goes, the models are picked in round-robin order
+type modelRoute struct {
+	Models []string
+	// Thinking and Search are used when the request does not set them
+	Thinking string
+	Search   string
+
+	next atomic.Uint64
+}
+
+func (r *modelRoute) pick() string {
+	return r.Models[(r.next.Add(1)-1)%uint64(len(r.Models))]
+}
+
+// parseModelRoute parses a target like kimi|doubao?thinking=enabled&search=disabled
+func parseModelRoute(s string) (*modelRoute, error) {
+	models, query, _ := strings.Cut(strings.TrimSpace(s), "?")
+	route := &modelRoute{}
+	for _, m := range strings.Split(models, "|") {
+		m = strings.TrimSpace(m)
+		if !browser.ExistModel(m) {
+			return nil, fmt.Errorf("model not found: %s", m)
+		}
+		route.Models = append(route.Models, m)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	for k := range values {
+		switch v := values.Get(k); k {
+		case "thinking":
+			route.Thinking = v
+		case "search":
+			route.Search = v
+		default:
+			return nil, fmt.Errorf("unknown option: %s", k)
+		}
+	}
+	return route, nil
+}
+
+var modelAliases = sync.OnceValue(func() map[string]*modelRoute {
+	aliases := map[string]*modelRoute{}
+	for alias, target := range config.G().ModelAliases {
+		route, err := parseModelRoute(target)
+		if err != nil {
+			logger.Error().Err(err).Str("alias", alias).Msg("invalid model alias")
+			continue
+		}
+		aliases[alias] = route
+	}
+	return aliases
+})
+
+var modelFallbacks = sync.OnceValue(func() map[string][]string {
+	fallbacks := map[string][]string{}
+	for model, target := range config.G().ModelFallbacks {
+		for _, m := range strings.Split(target, "|") {
+			m = strings.TrimSpace(m)
+			if !browser.ExistModel(m) {
+				logger.Error().Str("model", model).Msgf("fallback model not found: %s", m)
+				continue
+			}
+			fallbacks[model] = append(fallbacks[model], m)
+		}
+	}
+	return fallbacks
+})
+
+// modelChain returns the picked model followed by its fallbacks, the fallbacks of the requested name come first
+func modelChain(requested, picked string) []string {
+	chain := []string{picked}
+	for _, key := range []string{requested, picked} {
+		for _, m := range modelFallbacks()[key] {
+			if !slices.Contains(chain, m) {
+				chain = append(chain, m)
+			}
+		}
+	}
+	return chain
+}
+
+// resolveModel returns the route of model, a model id without alias routes to itself
+func resolveModel(model string) (*modelRoute, bool) {
+	if route, ok := modelAliases()[model]; ok {
+		return route, true
+	}
+	if browser.ExistModel(model) {
+		return &modelRoute{Models: []string{model}}, true
+	}
+	return nil, false
+}
+
+// modelUsable reports whether any model the name routes to may answer
+func modelUsable(model string) bool {
+	route, ok := resolveModel(model)
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(route.Models, browser.B().Usable)
+}
+
+// aliasNames returns the aliases that are not model ids themselves
+func aliasNames() []string {
+	return slices.DeleteFunc(slices.Sorted(maps.Keys(modelAliases())), browser.ExistModel)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestParseModelRoute(t *testing.T) {
+	route, err := parseModelRoute("kimi|doubao?thinking=enabled&search=disabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(route.Models) != 2 || route.Thinking != "enabled" || route.Search != "disabled" {
+		t.Fatalf("unexpected route: %+v", route)
+	}
+	if a, b, c := route.pick(), route.pick(), route.pick(); a != "kimi" || b != "doubao" || c != "kimi" {
+		t.Errorf("unexpected pick order: %s %s %s", a, b, c)
+	}
+
+	for _, s := range []string{"unknown", "qwen|", "qwen?foo=bar"} {
+		if _, err = parseModelRoute(s); err == nil {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+)
+
+const maxAttachmentSize = 20 << 20
+
+// attachmentClient only dials public addresses, so a client can not make the server read internal services,
+// the check is on the resolved ip of every connection, redirects included
+var attachmentClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// carrier grade nat, not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+	return nil
+}
+
+// saveAttachments writes every image of messages into a new temp dir, the caller removes the dir when done
+func saveAttachments(ctx context.Context, messages []*ChatCompletionMessage) (dir string, files []string, err error) {
+	for _, message := range messages {
+		if message.Content == nil {
+			continue
+		}
+		for _, part := range message.Content.ListValue {
+			if part.Type != "image_url" || part.ImageURL == nil || part.ImageURL.URL == "" {
+				continue
+			}
+			if dir == "" {
+				dir, err = os.MkdirTemp("", config.AppName+"-*")
+				if err != nil {
+					return "", nil, err
+				}
+			}
+			var file string
+			file, err = saveAttachment(ctx, dir, len(files), part.ImageURL.URL)
+			if err != nil {
+				_ = os.RemoveAll(dir)
+				return "", nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return dir, files, nil
+}
+
+func saveAttachment(ctx context.Context, dir string, index int, url string) (string, error) {
+	var (
+		data     []byte
+		mimeType string
+	)
+	switch {
+	case strings.HasPrefix(url, "data:"):
+		meta, payload, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return "", errx.BadRequest().WithMsgf("invalid image data url")
+		}
+		mimeType = strings.TrimSuffix(meta, ";base64")
+		bs, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", errx.BadRequest().WithMsgf("invalid image base64 data: %v", err)
+		}
+		data = bs
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		if !config.G().ApiImageFetch {
+			return "", errx.BadRequest().WithMsgf("image urls are disabled, send the image as a base64 data url")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", errx.BadRequest().WithMsgf("invalid image url: %v", err)
+		}
+		resp, err := attachmentClient.Do(req)
+		if err != nil {
+			return "", errx.BadRequest().WithMsgf("download image error: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return "", errx.BadRequest().WithMsgf("download image error: status %d", resp.StatusCode)
+		}
+		mimeType, _, _ = strings.Cut(resp.Header.Get("Content-Type"), ";")
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+		if err != nil {
+			return "", errx.BadRequest().WithMsgf("download image error: %v", err)
+		}
+	default:
+		return "", errx.BadRequest().WithMsgf("unsupported image url scheme")
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", errx.BadRequest().WithMsgf("unsupported image type: %q", mimeType)
+	}
+	if len(data) > maxAttachmentSize {
+		return "", errx.BadRequest().WithMsgf("image too large, max %d bytes", maxAttachmentSize)
+	}
+
+	ext := ".png"
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	file := filepath.Join(dir, fmt.Sprintf("image-%d%s", index+1, ext))
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return "", err
+	}
+	return file, nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/config"
+)
+
+func TestDialPublicOnly(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:80", "10.1.2.3:443", "192.168.1.1:80", "169.254.169.254:80", "100.64.0.1:80", "0.0.0.0:80", "[::1]:80", "[fd00::1]:80", "[fe80::1]:80", "[::ffff:127.0.0.1]:80"} {
+		if err := dialPublicOnly("tcp", addr, nil); err == nil {
+			t.Errorf("%s should be rejected", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34:443", "[2606:4700::1111]:443"} {
+		if err := dialPublicOnly("tcp", addr, nil); err != nil {
+			t.Errorf("%s should be allowed: %v", addr, err)
+		}
+	}
+}
+
+func TestSaveAttachment(t *testing.T) {
+	dir, ctx := t.TempDir(), context.Background()
+
+	if _, err := saveAttachment(ctx, dir, 0, "data:image/png;base64,iVBORw0KGgo="); err != nil {
+		t.Errorf("png data url: %v", err)
+	}
+	if _, err := saveAttachment(ctx, dir, 1, "data:text/plain;base64,aGk="); err == nil {
+		t.Error("text data url should be rejected")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+
+	if _, err := saveAttachment(ctx, dir, 2, srv.URL); err == nil {
+		t.Error("image url should be rejected when fetching is off")
+	}
+	config.G().ApiImageFetch = true
+	defer func() { config.G().ApiImageFetch = false }()
+	if _, err := saveAttachment(ctx, dir, 3, srv.URL); err == nil {
+		t.Error("loopback image url should be rejected")
+	}
+}
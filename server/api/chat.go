@@ -2,13 +2,19 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"strings"
 	"text/template"
 	"time"
 
+	"github.com/labstack/echo/v4"
 	"github.com/spf13/cast"
 
 	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/config"
 	"github.com/starudream/aichat-proxy/server/internal/errx"
 	"github.com/starudream/aichat-proxy/server/internal/json"
 	"github.com/starudream/aichat-proxy/server/logger"
@@ -26,6 +32,12 @@ type ChatCompletionReq struct {
 	Thinking *ChatCompletionThinking `json:"thinking,omitempty"`
 	// 工具
 	Tools []*ChatCompletionTool `json:"tools,omitempty"`
+	// 联网搜索配置，存在时开启联网搜索
+	WebSearchOptions *ChatCompletionWebSearchOptions `json:"web_search_options,omitempty"`
+	// 联网搜索，可选 auto、enabled、disabled，优先于 web_search_options，auto 保持页面当前状态，默认使用 BROWSER_SEARCH 配置（默认 disabled）
+	Search string `json:"search,omitempty"`
+	// 会话模式，历史消息与之前的对话一致时，继续该对话并仅发送新的消息
+	Session bool `json:"session,omitempty"`
 }
 
 type ChatCompletionMessage struct {
@@ -35,6 +47,12 @@ type ChatCompletionMessage struct {
 	Content *ChatCompletionMessageContent `json:"content"`
 	// 推理内容（仅响应）
 	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// 工具调用
+	ToolCalls []*ChatCompletionToolCall `json:"tool_calls,omitempty"`
+	// 工具调用 Id（仅 tool 角色）
+	ToolCallId string `json:"tool_call_id,omitempty"`
+	// 引用来源（仅响应）
+	Annotations []*ChatCompletionAnnotation `json:"annotations,omitempty"`
 }
 
 type ChatCompletionMessageContent struct {
@@ -46,6 +64,20 @@ type ChatCompletionMessageContent struct {
 
 var jsonNULL = []byte("null")
 
+func (v *ChatCompletionMessageContent) Text() string {
+	if v == nil {
+		return ""
+	}
+	if len(v.ListValue) == 0 {
+		return v.StringValue
+	}
+	ss := make([]string, 0, len(v.ListValue))
+	for _, part := range v.ListValue {
+		ss = append(ss, part.Text)
+	}
+	return strings.Join(ss, "\n")
+}
+
 func (v *ChatCompletionMessageContent) MarshalJSON() ([]byte, error) {
 	if v.StringValue != "" {
 		return json.Marshal(v.StringValue)
@@ -82,7 +114,7 @@ type ChatCompletionMessageContentPart struct {
 }
 
 type ChatMessageImageURL struct {
-	// 图片链接或图片的 Base64 编码
+	// 图片的 Base64 data url，或图片链接（需开启 API_IMAGE_FETCH，仅限公网地址）
 	URL string `json:"url"`
 	// 图片的质量，可选 high、low、auto
 	Detail string `json:"detail,omitempty"`
@@ -95,6 +127,50 @@ type ChatCompletionThinking struct {
 	Type string `json:"type"`
 }
 
+type ChatCompletionAnnotation struct {
+	// 类型，固定为 url_citation
+	Type string `json:"type"`
+	// 网页引用
+	URLCitation *ChatCompletionURLCitation `json:"url_citation"`
+}
+
+type ChatCompletionURLCitation struct {
+	// 标题
+	Title string `json:"title"`
+	// 链接
+	URL string `json:"url"`
+	// 引用在内容中的起始位置，网页端不提供，固定为 0
+	StartIndex int `json:"start_index"`
+	// 引用在内容中的结束位置，网页端不提供，固定为 0
+	EndIndex int `json:"end_index"`
+}
+
+func newAnnotations(citations []*browser.ChatCitation) (annotations []*ChatCompletionAnnotation) {
+	for _, v := range citations {
+		annotations = append(annotations, &ChatCompletionAnnotation{
+			Type:        "url_citation",
+			URLCitation: &ChatCompletionURLCitation{Title: v.Title, URL: v.URL},
+		})
+	}
+	return
+}
+
+type ChatCompletionWebSearchOptions struct {
+	// 搜索上下文大小，仅做兼容
+	SearchContextSize string `json:"search_context_size,omitempty"`
+}
+
+// webSearch resolves the web search option of the request
+func (r *ChatCompletionReq) webSearch() string {
+	if r.Search != "" {
+		return r.Search
+	}
+	if r.WebSearchOptions != nil {
+		return "enabled"
+	}
+	return ""
+}
+
 type ChatCompletionTool struct {
 	// 类型，可选 function
 	Type string `json:"type"`
@@ -156,6 +232,8 @@ type ChatCompletionTokens struct {
 var chatPrompt = template.Must(template.New("").
 	Funcs(map[string]any{
 		"jm": json.MarshalToString,
+		"tc": renderToolCall,
+		"ti": func() string { return toolCallInstruction },
 	}).
 	Parse(`
 {{- range $i, $message := .Messages }}
@@ -171,11 +249,22 @@ var chatPrompt = template.Must(template.New("").
 	{{- else if eq $message.Role "tool" }}
 		{{- print "【工具】\n" }}
 	{{- end }}
-	{{- range $j, $value := $message.Content.ListValue }}
-		{{- if gt $j 0 }}{{ print "\n" }}{{ end }}
-		{{- print $value.Text }}
-	{{- else }}
-		{{- print $message.Content.StringValue }}
+	{{- if $message.ToolCallId }}
+		{{- print "<tool_result id=\"" $message.ToolCallId "\">\n" }}
+	{{- end }}
+	{{- with $message.Content }}
+		{{- range $j, $value := .ListValue }}
+			{{- if gt $j 0 }}{{ print "\n" }}{{ end }}
+			{{- print $value.Text }}
+		{{- else }}
+			{{- print .StringValue }}
+		{{- end }}
+	{{- end }}
+	{{- if $message.ToolCallId }}
+		{{- print "\n</tool_result>" }}
+	{{- end }}
+	{{- range $j, $call := $message.ToolCalls }}
+		{{- print "\n" (tc $call) }}
 	{{- end }}
 {{ end }}
 {{- range $i, $tool := .Tools }}
@@ -190,8 +279,188 @@ var chatPrompt = template.Must(template.New("").
 		{{- jm $tool.Function.Parameters }}
 	{{- end }}
 {{ end }}
+{{- if .Tools }}
+	{{- print "~~~\n" (ti) "\n" }}
+{{- end }}
 `))
 
+// modelHeader tells the model that actually answered, it differs from the requested one with aliases or fallbacks
+const modelHeader = "X-Aichat-Proxy-Model"
+
+type chatTask struct {
+	req *ChatCompletionReq
+	hdr *browser.ChatHandler
+
+	promptN int
+	unix    int64
+}
+
+// startChat renders the prompt of req and hands it to the browser, it is shared by all chat like endpoints
+func startChat(c Ctx, req *ChatCompletionReq) (*chatTask, error) {
+	route, ok := resolveModel(req.Model)
+	if !ok {
+		return nil, errx.NotFound().WithMsgf("model not found: %s", req.Model)
+	}
+	model := route.pick()
+
+	options := browser.HandleChatOptions{
+		Account:   config.G().ApiKeyAccounts[apiKey(c)],
+		Thinking:  route.Thinking,
+		WebSearch: req.webSearch(),
+		Priority:  browser.Priority(config.G().ApiKeyPriorities[apiKey(c)]),
+	}
+	if req.Stream {
+		options.OnQueue = queueNotifier(c)
+	}
+	if req.Thinking != nil {
+		options.Thinking = req.Thinking.Type
+	}
+	if req.Search == "" && req.WebSearchOptions == nil && route.Search != "" {
+		options.WebSearch = route.Search
+	}
+
+	promptReq := req
+	if req.Session {
+		session, messages := findChatSession(req, options.Account)
+		if session != nil {
+			logger.Ctx(c.Request().Context()).Debug().Str("url", session.URL).Msg("continue chat session")
+			promptReq = &ChatCompletionReq{Messages: messages}
+			model = session.Model
+			options.Account = session.Account
+			options.Conversation = session.URL
+		}
+	}
+
+	dir, files, err := saveAttachments(c.Request().Context(), promptReq.Messages)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		// the files are uploaded into the page before HandleChat returns
+		defer func() { _ = os.RemoveAll(dir) }()
+	}
+	options.Files = files
+
+	buf := &bytes.Buffer{}
+	if err = chatPrompt.Execute(buf, promptReq); err != nil {
+		return nil, err
+	}
+	prompt := buf.String()
+
+	task := &chatTask{
+		req:     req,
+		promptN: tiktoken.NumTokens(prompt),
+		unix:    time.Now().Unix(),
+	}
+
+	chain := modelChain(req.Model, model)
+	if options.Conversation != "" {
+		// the conversation only exists in the provider of the session
+		chain = chain[:1]
+	}
+
+	// fall back to the next model until one answers, nothing has been written to the client yet
+	ctx := c.Request().Context()
+	for i, m := range chain {
+		task.hdr, err = browser.B().HandleChat(ctx, m, prompt, options)
+		if err == nil {
+			err = task.hdr.WaitAnswer(ctx)
+		}
+		if err == nil || ctx.Err() != nil || i == len(chain)-1 {
+			break
+		}
+		logger.Ctx(ctx).Warn().Err(err).Str("model", m).Msgf("chat failed, fall back to %s", chain[i+1])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reportModel(c, task.hdr.Model)
+
+	return task, nil
+}
+
+func setupSSE(w *echo.Response) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Transfer-Encoding", "chunked")
+}
+
+// reportModel tells the model that answered in modelHeader, Header().Set is a no-op once the queue comments sent the headers,
+// so an open stream gets it as an sse comment instead
+func reportModel(c Ctx, model string) {
+	w := c.Response()
+	if !w.Committed {
+		w.Header().Set(modelHeader, model)
+		return
+	}
+	if _, err := fmt.Fprintf(w, ": model %s\n\n", model); err != nil {
+		logger.Ctx(c.Request().Context()).Error().Err(err).Msg("write sse comment error")
+		return
+	}
+	w.Flush()
+}
+
+// queueNotifier keeps a streaming client alive with sse comments while the request waits for a page,
+// the headers go out with the first comment, so a later failure is sent as an error event
+func queueNotifier(c Ctx) func(position int) {
+	w := c.Response()
+	return func(position int) {
+		if !w.Committed {
+			setupSSE(w)
+			w.WriteHeader(http.StatusOK)
+		}
+		if _, err := fmt.Fprintf(w, ": queued, position %d\n\n", position); err != nil {
+			logger.Ctx(c.Request().Context()).Error().Err(err).Msg("write sse comment error")
+			return
+		}
+		w.Flush()
+	}
+}
+
+// chatStreamFailed sends the error as an error event when the stream is already open, or returns it otherwise
+func chatStreamFailed(c Ctx, err error) error {
+	w := c.Response()
+	if !w.Committed {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", json.MustMarshalToString(map[string]any{"error": streamError(err)}))
+	w.Flush()
+	return nil
+}
+
+// finishReason keeps the end state told by the provider, tool calls only replace a normal stop
+func finishReason(reason string, tcp *toolCallParser) string {
+	if reason == "" {
+		reason = browser.FinishStop
+	}
+	if tcp != nil && reason == browser.FinishStop {
+		return tcp.FinishReason()
+	}
+	return reason
+}
+
+// streamError is the error sent in the stream once the status line is out, it keeps the status of an errx or an echo error
+func streamError(err error) *errx.Error {
+	var ee *errx.Error
+	if errors.As(err, &ee) {
+		return ee
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return errx.Newf(he.Code, "%v", he.Message)
+	}
+	return errx.Default().WithMsgf("%s", err.Error())
+}
+
+// done is called with the whole content once the handler channel is closed
+func (t *chatTask) done(content string) {
+	if t.req.Session {
+		saveChatSession(t.req, t.hdr, content)
+	}
+}
+
 // Chat Completions
 //
 //	@router			/v1/chat/completions [post]
@@ -203,6 +472,7 @@ var chatPrompt = template.Must(template.New("").
 //	@produce		text/event-stream
 //	@param			*	body		ChatCompletionReq	true	"Request"
 //	@success		200	{object}	ChatCompletionResp
+//	@header			200	{string}	X-Aichat-Proxy-Model	"model that actually answered, sent as the sse comment ': model <id>' when the stream opened while queued"
 func hdrChatCompletions(c Ctx) error {
 	req := &ChatCompletionReq{}
 	if err := c.Bind(req); err != nil {
@@ -212,45 +482,48 @@ func hdrChatCompletions(c Ctx) error {
 		return err
 	}
 
-	if !browser.ExistModel(req.Model) {
-		return errx.NotFound().WithMsgf("model not found: %s", req.Model)
-	}
-
-	buf := &bytes.Buffer{}
-	if err := chatPrompt.Execute(buf, req); err != nil {
-		return err
+	task, err := startChat(c, req)
+	if err != nil {
+		return chatStreamFailed(c, err)
 	}
-	prompt := buf.String()
-	promptN := tiktoken.NumTokens(prompt)
+	hdr, promptN, unix := task.hdr, task.promptN, task.unix
 
 	ctx := c.Request().Context()
-	unix := time.Now().Unix()
 
-	options := browser.HandleChatOptions{}
-	if req.Thinking != nil {
-		options.Thinking = req.Thinking.Type
-	}
-
-	hdr, err := browser.B().HandleChat(ctx, req.Model, prompt, options)
-	if err != nil {
-		return err
+	var tcp *toolCallParser
+	if len(req.Tools) > 0 {
+		tcp = &toolCallParser{}
 	}
 
 	if !req.Stream {
-		content, reason := hdr.WaitFinish(ctx)
+		r := hdr.WaitFinish(ctx)
+		if r.Error != nil {
+			return r.Error
+		}
+		content, reason := r.Content, r.ReasoningContent
 		contentN, reasonN := tiktoken.NumTokens(content), tiktoken.NumTokens(reason)
+		if ctx.Err() == nil {
+			task.done(content)
+		}
+		message := &ChatCompletionMessage{
+			Role:             "assistant",
+			Content:          &ChatCompletionMessageContent{StringValue: content},
+			ReasoningContent: reason,
+			Annotations:      newAnnotations(r.Citations),
+		}
+		if tcp != nil {
+			text := strings.TrimSpace(tcp.Feed(content) + tcp.Flush())
+			message.Content = &ChatCompletionMessageContent{StringValue: text}
+			message.ToolCalls = tcp.Calls
+		}
 		return c.JSON(200, &ChatCompletionResp{
 			Id:      hdr.Id,
 			Object:  "chat.completion",
 			Created: unix,
-			Model:   req.Model,
+			Model:   hdr.Model,
 			Choices: []*ChatCompletionChoice{{
-				Message: &ChatCompletionMessage{
-					Role:             "assistant",
-					Content:          &ChatCompletionMessageContent{StringValue: content},
-					ReasoningContent: reason,
-				},
-				FinishReason: "stop",
+				Message:      message,
+				FinishReason: finishReason(r.FinishReason, tcp),
 			}},
 			Usage: &ChatCompletionUsage{
 				TotalTokens:      promptN + contentN + reasonN,
@@ -264,12 +537,34 @@ func hdrChatCompletions(c Ctx) error {
 	}
 
 	w := c.Response()
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Transfer-Encoding", "chunked")
+	setupSSE(w)
+
+	write := func(v any) error {
+		_, err := fmt.Fprintf(w, "data: %s\n\n", json.MustMarshalToString(v))
+		if err != nil {
+			logger.Ctx(ctx).Error().Err(err).Msg("write sse data error")
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	chunk := func(index int64, delta *ChatCompletionMessage, finishReason string) *ChatCompletionResp {
+		return &ChatCompletionResp{
+			Id:      hdr.Id,
+			Object:  "chat.completion.chunk",
+			Created: unix,
+			Model:   hdr.Model,
+			Choices: []*ChatCompletionChoice{{
+				Index:        index,
+				Delta:        delta,
+				FinishReason: finishReason,
+			}},
+		}
+	}
 
 	contentB, reasonB := &bytes.Buffer{}, &bytes.Buffer{}
+	var citations []*browser.ChatCitation
 
 	for {
 		select {
@@ -277,48 +572,82 @@ func hdrChatCompletions(c Ctx) error {
 			return ctx.Err()
 		case msg, ok := <-hdr.Ch:
 			if !ok {
+				task.done(contentB.String())
 				return nil
 			}
-			data := ""
+			if n := len(citations); len(msg.Citations) > 0 {
+				// only the citations not seen before are sent
+				citations = browser.MergeCitations(citations, msg.Citations...)
+				if len(citations) > n {
+					delta := &ChatCompletionMessage{Role: "assistant", Annotations: newAnnotations(citations[n:])}
+					if err = write(chunk(cast.To[int64](msg.Index), delta, "")); err != nil {
+						return err
+					}
+				}
+			}
+			if msg.Error != nil {
+				logger.Ctx(ctx).Error().Err(msg.Error).Msg("chat stream error")
+				return chatStreamFailed(c, msg.Error)
+			}
 			if msg.FinishReason == "" {
 				delta := &ChatCompletionMessage{Role: "assistant"}
 				if msg.Content != "" {
-					delta.Content = &ChatCompletionMessageContent{StringValue: msg.Content}
 					contentB.WriteString(msg.Content)
+					text := msg.Content
+					if tcp != nil {
+						text = tcp.Feed(text)
+					}
+					if text == "" {
+						continue
+					}
+					delta.Content = &ChatCompletionMessageContent{StringValue: text}
 				} else if msg.ReasoningContent != "" {
 					delta.ReasoningContent = msg.ReasoningContent
 					reasonB.WriteString(msg.ReasoningContent)
 				} else {
 					continue
 				}
-				data = json.MustMarshalToString(&ChatCompletionResp{
-					Id:      hdr.Id,
-					Object:  "chat.completion.chunk",
-					Created: unix,
-					Model:   req.Model,
-					Choices: []*ChatCompletionChoice{{
-						Index: cast.To[int64](msg.Index),
-						Delta: delta,
-					}},
-				})
-			} else {
-				contentN, reasonN := tiktoken.NumTokens(contentB.String()), tiktoken.NumTokens(reasonB.String())
-				data = json.MustMarshalToString(&ChatCompletionResp{
-					Object:  "chat.completion.chunk",
-					Created: unix,
-					Model:   req.Model,
-					Usage: &ChatCompletionUsage{
-						TotalTokens:      promptN + contentN + reasonN,
-						PromptTokens:     promptN,
-						CompletionTokens: contentN + reasonN,
-						CompletionTokensDetails: &ChatCompletionTokens{
-							ReasoningTokens: reasonN,
-						},
+				if err = write(chunk(cast.To[int64](msg.Index), delta, "")); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if tcp != nil {
+				if text := tcp.Flush(); text != "" {
+					if err = write(chunk(0, &ChatCompletionMessage{Role: "assistant", Content: &ChatCompletionMessageContent{StringValue: text}}, "")); err != nil {
+						return err
+					}
+				}
+				for i, call := range tcp.Calls {
+					call.Index = &i
+					if err = write(chunk(0, &ChatCompletionMessage{Role: "assistant", ToolCalls: []*ChatCompletionToolCall{call}}, "")); err != nil {
+						return err
+					}
+				}
+			}
+			if err = write(chunk(0, &ChatCompletionMessage{Role: "assistant"}, finishReason(msg.FinishReason, tcp))); err != nil {
+				return err
+			}
+
+			contentN, reasonN := tiktoken.NumTokens(contentB.String()), tiktoken.NumTokens(reasonB.String())
+			usage := &ChatCompletionResp{
+				Object:  "chat.completion.chunk",
+				Created: unix,
+				Model:   hdr.Model,
+				Usage: &ChatCompletionUsage{
+					TotalTokens:      promptN + contentN + reasonN,
+					PromptTokens:     promptN,
+					CompletionTokens: contentN + reasonN,
+					CompletionTokensDetails: &ChatCompletionTokens{
+						ReasoningTokens: reasonN,
 					},
-				})
-				data += "\n\ndata: [DONE]"
+				},
+			}
+			if err = write(usage); err != nil {
+				return err
 			}
-			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			_, err = fmt.Fprint(w, "data: [DONE]\n\n")
 			if err != nil {
 				logger.Ctx(ctx).Error().Err(err).Msg("write sse data error")
 				return err
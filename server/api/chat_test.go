@@ -3,8 +3,12 @@ package api
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/labstack/echo/v4"
+
 	"github.com/starudream/aichat-proxy/server/internal/json"
 	"github.com/starudream/aichat-proxy/server/tiktoken"
 )
@@ -48,6 +52,23 @@ func TestChatPrompt(t *testing.T) {
 						},
 					},
 				},
+				ToolCalls: []*ChatCompletionToolCall{
+					{
+						Id:   "call_1",
+						Type: "function",
+						Function: &ChatCompletionToolCallFunction{
+							Name:      "Bash",
+							Arguments: `{"command":"ls"}`,
+						},
+					},
+				},
+			},
+			{
+				Role:       "tool",
+				ToolCallId: "call_1",
+				Content: &ChatCompletionMessageContent{
+					StringValue: "go.mod",
+				},
 			},
 		},
 		Stream: true,
@@ -82,3 +103,24 @@ func TestChatPrompt(t *testing.T) {
 	fmt.Println("===")
 	fmt.Println(tiktoken.NumTokens(prompt))
 }
+
+func TestReportModel(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), rec)
+	reportModel(c, "kimi")
+	if v := c.Response().Header().Get(modelHeader); v != "kimi" {
+		t.Errorf("model header: %q", v)
+	}
+
+	// a queued stream has sent its headers, the model that answered after a fallback comes as a comment
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), rec)
+	queueNotifier(c)(1)
+	reportModel(c, "doubao")
+	if v := rec.Header().Get(modelHeader); v != "" {
+		t.Errorf("model header after commit: %q", v)
+	}
+	if v := rec.Body.String(); v != ": queued, position 1\n\n: model doubao\n\n" {
+		t.Errorf("unexpected stream: %q", v)
+	}
+}
@@ -0,0 +1,87 @@
+//go:build e2e
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/internal/fakechat"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+// TestE2EChatCompletions runs hdrChatCompletions against the fake chat site through playwright and the proxy,
+// run it with go test -tags e2e, it is skipped when firefox is not installed for playwright
+func TestE2EChatCompletions(t *testing.T) {
+	site, err := fakechat.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := site.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	if err = browser.StartFake(ctx, wg, site.Addr(), t.TempDir()); err != nil {
+		t.Skipf("browser not available: %v", err)
+	}
+
+	app := newApp()
+
+	t.Run("non-stream", func(t *testing.T) {
+		body := `{"model":"fake","messages":[{"role":"user","content":"hello fake world"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		if v := rec.Header().Get(modelHeader); v != "fake" {
+			t.Errorf("model header: %q", v)
+		}
+		resp, err := json.UnmarshalTo[*ChatCompletionResp](rec.Body.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := resp.Choices[0].Message
+		if !strings.Contains(message.Content.Text(), "hello fake world") {
+			t.Errorf("content: %q", message.Content.Text())
+		}
+		if message.ReasoningContent != "echo the prompt" {
+			t.Errorf("reasoning content: %q", message.ReasoningContent)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		body := `{"model":"fake","stream":true,"messages":[{"role":"user","content":"stream me please"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		out := rec.Body.String()
+		if rec.Code != 200 || !strings.HasSuffix(strings.TrimSpace(out), "data: [DONE]") {
+			t.Fatalf("status %d: %s", rec.Code, out)
+		}
+		if v := rec.Header().Get(modelHeader); v != "fake" {
+			t.Errorf("model header: %q", v)
+		}
+		for _, word := range []string{"stream", "me", "please"} {
+			if !strings.Contains(out, word) {
+				t.Errorf("word %s not streamed: %s", word, out)
+			}
+		}
+	})
+}
@@ -0,0 +1,490 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+	"github.com/starudream/aichat-proxy/server/tiktoken"
+)
+
+type MessageReq struct {
+	// 模型 Id
+	Model string `json:"model" validate:"required"`
+	// 消息列表
+	Messages []*MessageParam `json:"messages"`
+	// 系统提示词
+	System *MessageContent `json:"system,omitempty"`
+	// 最大输出 tokens，仅做兼容
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// 是否流式
+	Stream bool `json:"stream,omitempty"`
+	// 推理配置
+	Thinking *MessageThinking `json:"thinking,omitempty"`
+	// 工具
+	Tools []*MessageTool `json:"tools,omitempty"`
+}
+
+type MessageParam struct {
+	// 角色，可选 user、assistant
+	Role string `json:"role" validate:"required"`
+	// 内容
+	Content *MessageContent `json:"content"`
+}
+
+type MessageContent struct {
+	// 文本
+	StringValue string
+	// 数组
+	ListValue []*MessageContentBlock
+}
+
+func (v *MessageContent) MarshalJSON() ([]byte, error) {
+	if v.StringValue != "" {
+		return json.Marshal(v.StringValue)
+	} else if len(v.ListValue) > 0 {
+		return json.Marshal(v.ListValue)
+	} else {
+		return jsonNULL, nil
+	}
+}
+
+func (v *MessageContent) UnmarshalJSON(bs []byte) error {
+	var sv string
+	if err := json.Unmarshal(bs, &sv); err == nil {
+		*v = MessageContent{StringValue: sv}
+		return nil
+	}
+
+	var lv []*MessageContentBlock
+	if err := json.Unmarshal(bs, &lv); err == nil {
+		*v = MessageContent{ListValue: lv}
+		return nil
+	}
+
+	return nil
+}
+
+func (v *MessageContent) blocks() []*MessageContentBlock {
+	if v == nil {
+		return nil
+	}
+	if len(v.ListValue) == 0 && v.StringValue != "" {
+		return []*MessageContentBlock{{Type: "text", Text: v.StringValue}}
+	}
+	return v.ListValue
+}
+
+type MessageContentBlock struct {
+	// 类型，可选 text、image、tool_use、tool_result、thinking
+	Type string `json:"type"`
+	// 文本
+	Text string `json:"text,omitempty"`
+	// 图片
+	Source *MessageImageSource `json:"source,omitempty"`
+	// 工具调用 Id（tool_use）
+	Id string `json:"id,omitempty"`
+	// 工具名称（tool_use）
+	Name string `json:"name,omitempty"`
+	// 工具参数（tool_use）
+	Input any `json:"input,omitempty"`
+	// 工具调用 Id（tool_result）
+	ToolUseId string `json:"tool_use_id,omitempty"`
+	// 工具结果（tool_result）
+	Content *MessageContent `json:"content,omitempty"`
+	// 推理内容（thinking）
+	Thinking *string `json:"thinking,omitempty"`
+	// 推理签名（thinking）
+	Signature *string `json:"signature,omitempty"`
+}
+
+type MessageImageSource struct {
+	// 类型，可选 base64、url
+	Type string `json:"type"`
+	// 媒体类型，如 image/png
+	MediaType string `json:"media_type,omitempty"`
+	// Base64 编码的数据
+	Data string `json:"data,omitempty"`
+	// 图片链接
+	URL string `json:"url,omitempty"`
+}
+
+func (s *MessageImageSource) imageURL() string {
+	if s.Type == "base64" {
+		return "data:" + s.MediaType + ";base64," + s.Data
+	}
+	return s.URL
+}
+
+type MessageThinking struct {
+	// enabled：开启思考模式
+	// disabled：关闭思考模式
+	Type string `json:"type"`
+	// 思考预算 tokens，仅做兼容
+	BudgetTokens int `json:"budget_tokens,omitempty"`
+}
+
+type MessageTool struct {
+	// 类型，自定义工具为空，web_search_20250305 表示开启联网搜索
+	Type string `json:"type,omitempty"`
+	// 名称
+	Name string `json:"name"`
+	// 描述
+	Description string `json:"description,omitempty"`
+	// 参数列表
+	InputSchema any `json:"input_schema"`
+}
+
+type MessageResp struct {
+	// 消息 Id
+	Id string `json:"id"`
+	// 固定为 message
+	Type string `json:"type"`
+	// 固定为 assistant
+	Role string `json:"role"`
+	// 模型 Id
+	Model string `json:"model"`
+	// 内容
+	Content []*MessageContentBlock `json:"content"`
+	// 停止原因，可选 end_turn、max_tokens、tool_use、refusal
+	StopReason *string `json:"stop_reason"`
+	// 停止序列
+	StopSequence *string `json:"stop_sequence"`
+	// 用量
+	Usage *MessageUsage `json:"usage"`
+}
+
+type MessageUsage struct {
+	// 输入 tokens
+	InputTokens int `json:"input_tokens"`
+	// 输出 tokens
+	OutputTokens int `json:"output_tokens"`
+}
+
+// toChatCompletionReq converts the request, so it can share the prompt rendering of chat completions
+func (r *MessageReq) toChatCompletionReq() *ChatCompletionReq {
+	req := &ChatCompletionReq{Model: r.Model, Stream: r.Stream}
+
+	if system := r.System.blocks(); len(system) > 0 {
+		content := &ChatCompletionMessageContent{}
+		for _, block := range system {
+			content.ListValue = append(content.ListValue, &ChatCompletionMessageContentPart{Type: "text", Text: block.Text})
+		}
+		req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "system", Content: content})
+	}
+
+	for _, param := range r.Messages {
+		message := &ChatCompletionMessage{Role: param.Role, Content: &ChatCompletionMessageContent{}}
+		for _, block := range param.Content.blocks() {
+			switch block.Type {
+			case "text":
+				message.Content.ListValue = append(message.Content.ListValue, &ChatCompletionMessageContentPart{Type: "text", Text: block.Text})
+			case "image":
+				if block.Source != nil {
+					message.Content.ListValue = append(message.Content.ListValue, &ChatCompletionMessageContentPart{Type: "image_url", ImageURL: &ChatMessageImageURL{URL: block.Source.imageURL()}})
+				}
+			case "tool_use":
+				message.ToolCalls = append(message.ToolCalls, &ChatCompletionToolCall{
+					Id:       block.Id,
+					Type:     "function",
+					Function: &ChatCompletionToolCallFunction{Name: block.Name, Arguments: json.MustMarshalToString(block.Input)},
+				})
+			case "tool_result":
+				result := &ChatCompletionMessageContent{}
+				for _, v := range block.Content.blocks() {
+					if v.Type == "text" {
+						result.ListValue = append(result.ListValue, &ChatCompletionMessageContentPart{Type: "text", Text: v.Text})
+					}
+				}
+				req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "tool", ToolCallId: block.ToolUseId, Content: result})
+			}
+		}
+		if len(message.Content.ListValue) > 0 || len(message.ToolCalls) > 0 {
+			req.Messages = append(req.Messages, message)
+		}
+	}
+
+	if r.Thinking != nil {
+		req.Thinking = &ChatCompletionThinking{Type: r.Thinking.Type}
+	}
+
+	for _, tool := range r.Tools {
+		if strings.HasPrefix(tool.Type, "web_search") {
+			req.Search = "enabled"
+			continue
+		}
+		req.Tools = append(req.Tools, &ChatCompletionTool{
+			Type: "function",
+			Function: &ChatCompletionToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	return req
+}
+
+func messageStopReason(finishReason string) *string {
+	reason := "end_turn"
+	switch finishReason {
+	case "tool_calls":
+		reason = "tool_use"
+	case "length":
+		reason = "max_tokens"
+	case "content_filter":
+		reason = "refusal"
+	}
+	return &reason
+}
+
+// messageErrorType maps the status of an error to the error type of anthropic
+func messageErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+// messageFailed renders the error in the format of anthropic, as the body or as an error event when the stream is already open
+func messageFailed(c Ctx, err error) error {
+	ee := streamError(err)
+	v := map[string]any{"type": "error", "error": map[string]any{"type": messageErrorType(ee.Status), "message": ee.Message}}
+	w := c.Response()
+	if !w.Committed {
+		return c.JSON(ee.Status, v)
+	}
+	_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", json.MustMarshalToString(v))
+	w.Flush()
+	return nil
+}
+
+func toolUseBlock(call *ChatCompletionToolCall) *MessageContentBlock {
+	input, err := json.UnmarshalTo[any](call.Function.Arguments)
+	if err != nil || input == nil {
+		input = map[string]any{}
+	}
+	return &MessageContentBlock{Type: "tool_use", Id: call.Id, Name: call.Function.Name, Input: input}
+}
+
+// Messages
+//
+//	@router			/v1/messages [post]
+//	@summary		Messages
+//	@description	Follows the exact same API spec as `https://docs.anthropic.com/en/api/messages`
+//	@tags			chat
+//	@security		ApiKeyAuth
+//	@produce		json
+//	@produce		text/event-stream
+//	@param			*	body		MessageReq	true	"Request"
+//	@success		200	{object}	MessageResp
+//	@header			200	{string}	X-Aichat-Proxy-Model	"model that actually answered, sent as the sse comment ': model <id>' when the stream opened while queued"
+func hdrMessages(c Ctx) error {
+	req := &MessageReq{}
+	if err := c.Bind(req); err != nil {
+		return messageFailed(c, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return messageFailed(c, errx.BadRequest().WithMsgf("%s", err.Error()))
+	}
+
+	task, err := startChat(c, req.toChatCompletionReq())
+	if err != nil {
+		return messageFailed(c, err)
+	}
+	hdr, promptN := task.hdr, task.promptN
+
+	ctx := c.Request().Context()
+
+	var tcp *toolCallParser
+	if len(req.Tools) > 0 {
+		tcp = &toolCallParser{}
+	}
+
+	if !req.Stream {
+		r := hdr.WaitFinish(ctx)
+		if r.Error != nil {
+			return messageFailed(c, r.Error)
+		}
+		content, reason := r.Content, r.ReasoningContent
+		if ctx.Err() == nil {
+			task.done(content)
+		}
+		resp := &MessageResp{
+			Id:      hdr.Id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   hdr.Model,
+			Content: []*MessageContentBlock{},
+			Usage: &MessageUsage{
+				InputTokens:  promptN,
+				OutputTokens: tiktoken.NumTokens(content) + tiktoken.NumTokens(reason),
+			},
+		}
+		if reason != "" {
+			resp.Content = append(resp.Content, &MessageContentBlock{Type: "thinking", Thinking: &reason, Signature: new(string)})
+		}
+		if tcp != nil {
+			content = tcp.Feed(content) + tcp.Flush()
+		}
+		if content != "" {
+			resp.Content = append(resp.Content, &MessageContentBlock{Type: "text", Text: content})
+		}
+		if tcp != nil {
+			for _, call := range tcp.Calls {
+				resp.Content = append(resp.Content, toolUseBlock(call))
+			}
+		}
+		resp.StopReason = messageStopReason(finishReason(r.FinishReason, tcp))
+		return c.JSON(200, resp)
+	}
+
+	w := c.Response()
+	setupSSE(w)
+
+	write := func(event string, v any) error {
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, json.MustMarshalToString(v))
+		if err != nil {
+			logger.Ctx(ctx).Error().Err(err).Msg("write sse data error")
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	// index of the current content block, -1 means no block is open
+	index, blockType := -1, ""
+
+	startBlock := func(block map[string]any) error {
+		if blockType != "" {
+			if err := write("content_block_stop", map[string]any{"type": "content_block_stop", "index": index}); err != nil {
+				return err
+			}
+			blockType = ""
+		}
+		if block == nil {
+			return nil
+		}
+		index++
+		blockType = block["type"].(string)
+		return write("content_block_start", map[string]any{"type": "content_block_start", "index": index, "content_block": block})
+	}
+
+	writeDelta := func(typ string, delta map[string]any) error {
+		if blockType != typ {
+			block := map[string]any{"type": typ}
+			switch typ {
+			case "thinking":
+				block["thinking"], block["signature"] = "", ""
+			case "text":
+				block["text"] = ""
+			}
+			if err := startBlock(block); err != nil {
+				return err
+			}
+		}
+		return write("content_block_delta", map[string]any{"type": "content_block_delta", "index": index, "delta": delta})
+	}
+
+	err = write("message_start", map[string]any{
+		"type": "message_start",
+		"message": &MessageResp{
+			Id:      hdr.Id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   hdr.Model,
+			Content: []*MessageContentBlock{},
+			Usage:   &MessageUsage{InputTokens: promptN},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	contentB, reasonB := &bytes.Buffer{}, &bytes.Buffer{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-hdr.Ch:
+			if !ok {
+				task.done(contentB.String())
+				return nil
+			}
+			if msg.Error != nil {
+				logger.Ctx(ctx).Error().Err(msg.Error).Msg("chat stream error")
+				return messageFailed(c, msg.Error)
+			}
+			if msg.FinishReason == "" {
+				if msg.Content != "" {
+					contentB.WriteString(msg.Content)
+					text := msg.Content
+					if tcp != nil {
+						text = tcp.Feed(text)
+					}
+					if text != "" {
+						if err = writeDelta("text", map[string]any{"type": "text_delta", "text": text}); err != nil {
+							return err
+						}
+					}
+				} else if msg.ReasoningContent != "" {
+					reasonB.WriteString(msg.ReasoningContent)
+					if err = writeDelta("thinking", map[string]any{"type": "thinking_delta", "thinking": msg.ReasoningContent}); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if tcp != nil {
+				if text := tcp.Flush(); text != "" {
+					if err = writeDelta("text", map[string]any{"type": "text_delta", "text": text}); err != nil {
+						return err
+					}
+				}
+				for _, call := range tcp.Calls {
+					block := map[string]any{"type": "tool_use", "id": call.Id, "name": call.Function.Name, "input": map[string]any{}}
+					if err = startBlock(block); err != nil {
+						return err
+					}
+					if err = writeDelta("tool_use", map[string]any{"type": "input_json_delta", "partial_json": call.Function.Arguments}); err != nil {
+						return err
+					}
+				}
+			}
+			if err = startBlock(nil); err != nil {
+				return err
+			}
+
+			outputN := tiktoken.NumTokens(contentB.String()) + tiktoken.NumTokens(reasonB.String())
+			err = write("message_delta", map[string]any{
+				"type":  "message_delta",
+				"delta": map[string]any{"stop_reason": messageStopReason(finishReason(msg.FinishReason, tcp)), "stop_sequence": nil},
+				"usage": &MessageUsage{InputTokens: promptN, OutputTokens: outputN},
+			})
+			if err != nil {
+				return err
+			}
+			if err = write("message_stop", map[string]any{"type": "message_stop"}); err != nil {
+				return err
+			}
+		}
+	}
+}
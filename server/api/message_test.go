@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+func TestMessageToChatCompletionReq(t *testing.T) {
+	r, err := json.UnmarshalTo[*MessageReq](`{
+		"model": "kimi",
+		"stream": true,
+		"system": [{"type": "text", "text": "be brief"}],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "list files"}, {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}]},
+			{"role": "assistant", "content": [{"type": "thinking", "thinking": "use ls"}, {"type": "tool_use", "id": "call_1", "name": "Bash", "input": {"command": "ls"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "content": "go.mod"}]}
+		],
+		"thinking": {"type": "enabled", "budget_tokens": 1024},
+		"tools": [{"type": "web_search_20250305", "name": "web_search"}, {"name": "Bash", "input_schema": {"type": "object"}}]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := r.toChatCompletionReq()
+	if req.Model != "kimi" || !req.Stream || req.Search != "enabled" || req.Thinking == nil || req.Thinking.Type != "enabled" {
+		t.Fatalf("unexpected request: %s", json.MustMarshalToString(req))
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "Bash" {
+		t.Errorf("unexpected tools: %s", json.MustMarshalToString(req.Tools))
+	}
+	if len(req.Messages) != 4 {
+		t.Fatalf("want 4 messages, got %s", json.MustMarshalToString(req.Messages))
+	}
+	if m := req.Messages[0]; m.Role != "system" || m.Content.Text() != "be brief" {
+		t.Errorf("unexpected system message: %s", json.MustMarshalToString(m))
+	}
+	if m := req.Messages[1]; m.Role != "user" || len(m.Content.ListValue) != 2 || m.Content.ListValue[1].ImageURL.URL != "data:image/png;base64,AAAA" {
+		t.Errorf("unexpected user message: %s", json.MustMarshalToString(m))
+	}
+	if m := req.Messages[2]; m.Role != "assistant" || len(m.ToolCalls) != 1 || m.ToolCalls[0].Function.Arguments != `{"command":"ls"}` {
+		t.Errorf("unexpected assistant message: %s", json.MustMarshalToString(m))
+	}
+	if m := req.Messages[3]; m.Role != "tool" || m.ToolCallId != "call_1" || m.Content.Text() != "go.mod" {
+		t.Errorf("unexpected tool message: %s", json.MustMarshalToString(m))
+	}
+}
+
+func TestMessageResp(t *testing.T) {
+	for reason, want := range map[string]string{"stop": "end_turn", "tool_calls": "tool_use", "length": "max_tokens", "content_filter": "refusal"} {
+		if v := *messageStopReason(reason); v != want {
+			t.Errorf("stop reason of %s: want %s, got %s", reason, want, v)
+		}
+	}
+
+	block := toolUseBlock(&ChatCompletionToolCall{Id: "call_1", Function: &ChatCompletionToolCallFunction{Name: "Bash", Arguments: `{"command":"ls"}`}})
+	if v := json.MustMarshalToString(block); v != `{"type":"tool_use","id":"call_1","name":"Bash","input":{"command":"ls"}}` {
+		t.Errorf("unexpected tool use block: %s", v)
+	}
+	block = toolUseBlock(&ChatCompletionToolCall{Id: "call_2", Function: &ChatCompletionToolCallFunction{Name: "Bash", Arguments: "not json"}})
+	if v := json.MustMarshalToString(block.Input); v != `{}` {
+		t.Errorf("invalid arguments should be an empty input, got %s", v)
+	}
+}
+
+func TestMessageFailed(t *testing.T) {
+	newCtx := func() (Ctx, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		return echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/messages", nil), rec), rec
+	}
+
+	c, rec := newCtx()
+	if err := messageFailed(c, errx.TooManyRequests().WithMsgf("busy")); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status: %d", rec.Code)
+	}
+	if v := strings.TrimSpace(rec.Body.String()); v != `{"error":{"message":"busy","type":"rate_limit_error"},"type":"error"}` {
+		t.Errorf("unexpected body: %s", v)
+	}
+
+	c, rec = newCtx()
+	if err := messageFailed(c, echo.NewHTTPError(http.StatusBadRequest, "bad json")); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"invalid_request_error"`) {
+		t.Errorf("unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+
+	c, rec = newCtx()
+	c.Response().WriteHeader(http.StatusOK)
+	if err := messageFailed(c, errx.GatewayTimeout().WithMsgf("idle")); err != nil {
+		t.Fatal(err)
+	}
+	if v := rec.Body.String(); !strings.HasPrefix(v, "event: error\ndata: ") || !strings.Contains(v, `"message":"idle"`) {
+		t.Errorf("unexpected event: %q", v)
+	}
+}
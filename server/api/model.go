@@ -32,7 +32,10 @@ const defaultCreated = 1751731200
 //	@success		200	{object}	ListModelResp
 func hdrModels(c Ctx) error {
 	models := make([]*Model, 0)
-	for _, m := range browser.Models() {
+	for _, m := range append(browser.Models(), aliasNames()...) {
+		if config.G().ModelHideUnusable && !modelUsable(m) {
+			continue
+		}
 		models = append(models, &Model{
 			Id:      m,
 			Object:  "model",
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+)
+
+type ListProviderResp struct {
+	// 固定为 list
+	Object string `json:"object"`
+	// 提供方列表
+	Data []*Provider `json:"data"`
+}
+
+type Provider struct {
+	// 提供方 Id，即不带变体的模型 Id
+	Id string `json:"id"`
+	// 状态，取所有账号中最可用的状态，可选 ready、logged_out、captcha、busy、error、unknown
+	State string `json:"state"`
+	// 最近一次成功回答的时间戳
+	LastSuccessAt int64 `json:"last_success_at,omitempty"`
+	// 各账号的状态
+	Accounts []*ProviderAccount `json:"accounts"`
+}
+
+type ProviderAccount struct {
+	// 账号
+	Account string `json:"account"`
+	// 状态
+	State string `json:"state"`
+	// 错误信息
+	Error string `json:"error,omitempty"`
+	// 最近一次检查的时间戳
+	CheckedAt int64 `json:"checked_at,omitempty"`
+	// 最近一次成功回答的时间戳
+	LastSuccessAt int64 `json:"last_success_at,omitempty"`
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Provider List
+//
+//	@router			/v1/providers [get]
+//	@summary		Provider List
+//	@description	Login and health state of every provider, probed periodically and updated by every chat
+//	@tags			model
+//	@security		ApiKeyAuth
+//	@success		200	{object}	ListProviderResp
+func hdrProviders(c Ctx) error {
+	return c.JSON(200, &ListProviderResp{Object: "list", Data: listProviders()})
+}
+
+func listProviders() []*Provider {
+	providers := make([]*Provider, 0)
+	for _, p := range browser.B().Providers() {
+		provider := &Provider{Id: p.Name, State: p.State, LastSuccessAt: unixOrZero(p.LastSuccess), Accounts: []*ProviderAccount{}}
+		for _, a := range p.Accounts {
+			provider.Accounts = append(provider.Accounts, &ProviderAccount{
+				Account:       a.Account,
+				State:         a.State,
+				Error:         a.Error,
+				CheckedAt:     unixOrZero(a.CheckedAt),
+				LastSuccessAt: unixOrZero(a.LastSuccess),
+			})
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
@@ -0,0 +1,645 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+	"github.com/starudream/aichat-proxy/server/tiktoken"
+)
+
+type ResponseReq struct {
+	// 模型 Id
+	Model string `json:"model" validate:"required"`
+	// 输入
+	Input *ResponseInput `json:"input"`
+	// 系统提示词
+	Instructions string `json:"instructions,omitempty"`
+	// 是否流式
+	Stream bool `json:"stream,omitempty"`
+	// 推理配置
+	Reasoning *ResponseReasoning `json:"reasoning,omitempty"`
+	// 工具
+	Tools []*ResponseTool `json:"tools,omitempty"`
+}
+
+type ResponseInput struct {
+	// 文本
+	StringValue string
+	// 数组
+	ListValue []*ResponseInputItem
+}
+
+func (v *ResponseInput) MarshalJSON() ([]byte, error) {
+	if v.StringValue != "" {
+		return json.Marshal(v.StringValue)
+	} else if len(v.ListValue) > 0 {
+		return json.Marshal(v.ListValue)
+	} else {
+		return jsonNULL, nil
+	}
+}
+
+func (v *ResponseInput) UnmarshalJSON(bs []byte) error {
+	var sv string
+	if err := json.Unmarshal(bs, &sv); err == nil {
+		*v = ResponseInput{StringValue: sv}
+		return nil
+	}
+
+	var lv []*ResponseInputItem
+	if err := json.Unmarshal(bs, &lv); err == nil {
+		*v = ResponseInput{ListValue: lv}
+		return nil
+	}
+
+	return nil
+}
+
+type ResponseInputItem struct {
+	// 类型，可选 message、function_call、function_call_output，为空时视为 message
+	Type string `json:"type,omitempty"`
+	// 角色，可选 system、developer、user、assistant（message）
+	Role string `json:"role,omitempty"`
+	// 内容（message）
+	Content *ResponseInputContent `json:"content,omitempty"`
+	// 工具调用 Id（function_call、function_call_output）
+	CallId string `json:"call_id,omitempty"`
+	// 工具名称（function_call）
+	Name string `json:"name,omitempty"`
+	// 工具参数，JSON 字符串（function_call）
+	Arguments string `json:"arguments,omitempty"`
+	// 工具结果（function_call_output）
+	Output string `json:"output,omitempty"`
+}
+
+type ResponseInputContent struct {
+	// 文本
+	StringValue string
+	// 数组
+	ListValue []*ResponseInputContentPart
+}
+
+func (v *ResponseInputContent) MarshalJSON() ([]byte, error) {
+	if v.StringValue != "" {
+		return json.Marshal(v.StringValue)
+	} else if len(v.ListValue) > 0 {
+		return json.Marshal(v.ListValue)
+	} else {
+		return jsonNULL, nil
+	}
+}
+
+func (v *ResponseInputContent) UnmarshalJSON(bs []byte) error {
+	var sv string
+	if err := json.Unmarshal(bs, &sv); err == nil {
+		*v = ResponseInputContent{StringValue: sv}
+		return nil
+	}
+
+	var lv []*ResponseInputContentPart
+	if err := json.Unmarshal(bs, &lv); err == nil {
+		*v = ResponseInputContent{ListValue: lv}
+		return nil
+	}
+
+	return nil
+}
+
+type ResponseInputContentPart struct {
+	// 类型，可选 input_text、output_text、input_image
+	Type string `json:"type"`
+	// 文本
+	Text string `json:"text,omitempty"`
+	// 图片链接或图片的 Base64 编码
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+type ResponseReasoning struct {
+	// 推理强度，可选 minimal、low、medium、high，minimal 时关闭思考模式
+	Effort string `json:"effort,omitempty"`
+	// 推理摘要，仅做兼容
+	Summary string `json:"summary,omitempty"`
+}
+
+type ResponseTool struct {
+	// 类型，可选 function、web_search、web_search_preview
+	Type string `json:"type"`
+	// 名称
+	Name string `json:"name"`
+	// 描述
+	Description string `json:"description,omitempty"`
+	// 参数列表
+	Parameters any `json:"parameters"`
+}
+
+type ResponseResp struct {
+	// 响应 Id
+	Id string `json:"id"`
+	// 固定为 response
+	Object string `json:"object"`
+	// 创建的时间戳（秒级）
+	CreatedAt int64 `json:"created_at"`
+	// 状态，可选 in_progress、completed、incomplete、failed
+	Status string `json:"status"`
+	// 未完成的原因，仅 incomplete 时存在
+	IncompleteDetails *ResponseIncompleteDetails `json:"incomplete_details,omitempty"`
+	// 错误，仅 failed 时存在
+	Error *ResponseError `json:"error,omitempty"`
+	// 模型 Id
+	Model string `json:"model"`
+	// 输出
+	Output []*ResponseOutputItem `json:"output"`
+	// 用量
+	Usage *ResponseUsage `json:"usage,omitempty"`
+}
+
+type ResponseIncompleteDetails struct {
+	// 原因，可选 max_output_tokens、content_filter
+	Reason string `json:"reason"`
+}
+
+type ResponseError struct {
+	// 错误码，可选 server_error、rate_limit_exceeded
+	Code string `json:"code"`
+	// 错误信息
+	Message string `json:"message"`
+}
+
+// finish sets the status of the response from the finish reason, and returns the event that ends the stream
+func (r *ResponseResp) finish(finishReason string) string {
+	switch finishReason {
+	case browser.FinishLength:
+		r.Status, r.IncompleteDetails = "incomplete", &ResponseIncompleteDetails{Reason: "max_output_tokens"}
+	case browser.FinishContentFilter:
+		r.Status, r.IncompleteDetails = "incomplete", &ResponseIncompleteDetails{Reason: "content_filter"}
+	default:
+		r.Status = "completed"
+	}
+	return "response." + r.Status
+}
+
+// responseStreamFailed sends the error as an error event when the stream is already open, or returns it otherwise,
+// it is only for the failures before the response is created
+func responseStreamFailed(c Ctx, err error) error {
+	w := c.Response()
+	if !w.Committed {
+		return err
+	}
+	r := &ResponseResp{}
+	r.fail(err)
+	v := map[string]any{"type": "error", "code": r.Error.Code, "message": r.Error.Message, "param": nil, "sequence_number": 0}
+	_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", json.MustMarshalToString(v))
+	w.Flush()
+	return nil
+}
+
+// fail sets the status of the response from an error in the stream
+func (r *ResponseResp) fail(err error) {
+	ee := streamError(err)
+	r.Status, r.Error = "failed", &ResponseError{Code: "server_error", Message: ee.Message}
+	if ee.Status == http.StatusTooManyRequests {
+		r.Error.Code = "rate_limit_exceeded"
+	}
+}
+
+type ResponseOutputItem struct {
+	// 类型，可选 reasoning、message、function_call
+	Type string `json:"type"`
+	// 输出项 Id
+	Id string `json:"id"`
+	// 状态，可选 in_progress、completed
+	Status string `json:"status,omitempty"`
+	// 角色（message）
+	Role string `json:"role,omitempty"`
+	// 内容（message）
+	Content []*ResponseOutputText `json:"content,omitempty"`
+	// 推理摘要（reasoning）
+	Summary []*ResponseSummaryText `json:"summary,omitempty"`
+	// 工具调用 Id（function_call）
+	CallId string `json:"call_id,omitempty"`
+	// 工具名称（function_call）
+	Name string `json:"name,omitempty"`
+	// 工具参数，JSON 字符串（function_call）
+	Arguments string `json:"arguments,omitempty"`
+}
+
+type ResponseOutputText struct {
+	// 固定为 output_text
+	Type string `json:"type"`
+	// 文本
+	Text string `json:"text"`
+	// 注释
+	Annotations []any `json:"annotations"`
+}
+
+type ResponseURLCitation struct {
+	// 固定为 url_citation
+	Type string `json:"type"`
+	// 标题
+	Title string `json:"title"`
+	// 链接
+	URL string `json:"url"`
+	// 引用在文本中的起始位置，网页端不提供，固定为 0
+	StartIndex int `json:"start_index"`
+	// 引用在文本中的结束位置，网页端不提供，固定为 0
+	EndIndex int `json:"end_index"`
+}
+
+func newResponseAnnotations(citations []*browser.ChatCitation) []any {
+	annotations := make([]any, 0, len(citations))
+	for _, v := range citations {
+		annotations = append(annotations, &ResponseURLCitation{Type: "url_citation", Title: v.Title, URL: v.URL})
+	}
+	return annotations
+}
+
+type ResponseSummaryText struct {
+	// 固定为 summary_text
+	Type string `json:"type"`
+	// 文本
+	Text string `json:"text"`
+}
+
+type ResponseUsage struct {
+	// 输入 tokens
+	InputTokens int `json:"input_tokens"`
+	// 输出 tokens
+	OutputTokens int `json:"output_tokens"`
+	// 总消耗 tokens
+	TotalTokens int `json:"total_tokens"`
+	// 输出 tokens
+	OutputTokensDetails *ResponseOutputTokens `json:"output_tokens_details"`
+}
+
+type ResponseOutputTokens struct {
+	// 思维链 tokens
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+func newResponseUsage(promptN int, content, reason string) *ResponseUsage {
+	contentN, reasonN := tiktoken.NumTokens(content), tiktoken.NumTokens(reason)
+	return &ResponseUsage{
+		InputTokens:         promptN,
+		OutputTokens:        contentN + reasonN,
+		TotalTokens:         promptN + contentN + reasonN,
+		OutputTokensDetails: &ResponseOutputTokens{ReasoningTokens: reasonN},
+	}
+}
+
+// toChatCompletionReq converts the request, so it can share the prompt rendering of chat completions
+func (r *ResponseReq) toChatCompletionReq() *ChatCompletionReq {
+	req := &ChatCompletionReq{Model: r.Model, Stream: r.Stream}
+
+	if r.Instructions != "" {
+		req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "system", Content: &ChatCompletionMessageContent{StringValue: r.Instructions}})
+	}
+
+	if r.Input != nil && r.Input.StringValue != "" {
+		req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "user", Content: &ChatCompletionMessageContent{StringValue: r.Input.StringValue}})
+	}
+
+	for _, item := range r.inputItems() {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			content := &ChatCompletionMessageContent{}
+			if item.Content != nil {
+				content.StringValue = item.Content.StringValue
+				for _, part := range item.Content.ListValue {
+					switch part.Type {
+					case "input_text", "output_text":
+						content.ListValue = append(content.ListValue, &ChatCompletionMessageContentPart{Type: "text", Text: part.Text})
+					case "input_image":
+						content.ListValue = append(content.ListValue, &ChatCompletionMessageContentPart{Type: "image_url", ImageURL: &ChatMessageImageURL{URL: part.ImageURL}})
+					}
+				}
+			}
+			req.Messages = append(req.Messages, &ChatCompletionMessage{Role: role, Content: content})
+		case "function_call":
+			call := &ChatCompletionToolCall{
+				Id:       item.CallId,
+				Type:     "function",
+				Function: &ChatCompletionToolCallFunction{Name: item.Name, Arguments: item.Arguments},
+			}
+			// consecutive calls belong to the same assistant message
+			if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == "assistant" {
+				req.Messages[n-1].ToolCalls = append(req.Messages[n-1].ToolCalls, call)
+			} else {
+				req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "assistant", ToolCalls: []*ChatCompletionToolCall{call}})
+			}
+		case "function_call_output":
+			req.Messages = append(req.Messages, &ChatCompletionMessage{Role: "tool", ToolCallId: item.CallId, Content: &ChatCompletionMessageContent{StringValue: item.Output}})
+		}
+	}
+
+	if r.Reasoning != nil && r.Reasoning.Effort != "" {
+		req.Thinking = &ChatCompletionThinking{Type: "enabled"}
+		if r.Reasoning.Effort == "minimal" || r.Reasoning.Effort == "none" {
+			req.Thinking.Type = "disabled"
+		}
+	}
+
+	for _, tool := range r.Tools {
+		if strings.HasPrefix(tool.Type, "web_search") {
+			req.Search = "enabled"
+			continue
+		}
+		if tool.Type != "function" {
+			continue
+		}
+		req.Tools = append(req.Tools, &ChatCompletionTool{
+			Type: "function",
+			Function: &ChatCompletionToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return req
+}
+
+func (r *ResponseReq) inputItems() []*ResponseInputItem {
+	if r.Input == nil {
+		return nil
+	}
+	return r.Input.ListValue
+}
+
+func functionCallItem(call *ChatCompletionToolCall) *ResponseOutputItem {
+	return &ResponseOutputItem{
+		Type:      "function_call",
+		Id:        "fc_" + call.Id,
+		Status:    "completed",
+		CallId:    call.Id,
+		Name:      call.Function.Name,
+		Arguments: call.Function.Arguments,
+	}
+}
+
+// Responses
+//
+//	@router			/v1/responses [post]
+//	@summary		Responses
+//	@description	Follows the exact same API spec as `https://platform.openai.com/docs/api-reference/responses`
+//	@tags			chat
+//	@security		ApiKeyAuth
+//	@produce		json
+//	@produce		text/event-stream
+//	@param			*	body		ResponseReq	true	"Request"
+//	@success		200	{object}	ResponseResp
+//	@header			200	{string}	X-Aichat-Proxy-Model	"model that actually answered, sent as the sse comment ': model <id>' when the stream opened while queued"
+func hdrResponses(c Ctx) error {
+	req := &ResponseReq{}
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	task, err := startChat(c, req.toChatCompletionReq())
+	if err != nil {
+		return responseStreamFailed(c, err)
+	}
+	hdr, promptN := task.hdr, task.promptN
+
+	ctx := c.Request().Context()
+
+	var tcp *toolCallParser
+	if len(task.req.Tools) > 0 {
+		tcp = &toolCallParser{}
+	}
+
+	resp := &ResponseResp{
+		Id:        "resp_" + hdr.Id,
+		Object:    "response",
+		CreatedAt: task.unix,
+		Status:    "in_progress",
+		Model:     hdr.Model,
+		Output:    []*ResponseOutputItem{},
+	}
+
+	if !req.Stream {
+		r := hdr.WaitFinish(ctx)
+		if r.Error != nil {
+			return r.Error
+		}
+		content, reason, citations := r.Content, r.ReasoningContent, r.Citations
+		if ctx.Err() == nil {
+			task.done(content)
+		}
+		if reason != "" {
+			resp.Output = append(resp.Output, &ResponseOutputItem{
+				Type:    "reasoning",
+				Id:      "rs_" + hdr.Id,
+				Summary: []*ResponseSummaryText{{Type: "summary_text", Text: reason}},
+			})
+		}
+		text := content
+		if tcp != nil {
+			text = tcp.Feed(content) + tcp.Flush()
+		}
+		if text != "" {
+			resp.Output = append(resp.Output, &ResponseOutputItem{
+				Type:    "message",
+				Id:      "msg_" + hdr.Id,
+				Status:  "completed",
+				Role:    "assistant",
+				Content: []*ResponseOutputText{{Type: "output_text", Text: text, Annotations: newResponseAnnotations(citations)}},
+			})
+		}
+		if tcp != nil {
+			for _, call := range tcp.Calls {
+				resp.Output = append(resp.Output, functionCallItem(call))
+			}
+		}
+		resp.finish(r.FinishReason)
+		resp.Usage = newResponseUsage(promptN, content, reason)
+		return c.JSON(200, resp)
+	}
+
+	w := c.Response()
+	setupSSE(w)
+
+	seq := 0
+	write := func(event string, v map[string]any) error {
+		v["type"], v["sequence_number"] = event, seq
+		seq++
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, json.MustMarshalToString(v))
+		if err != nil {
+			logger.Ctx(ctx).Error().Err(err).Msg("write sse data error")
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	// item is the output item being streamed, text holds its text so far
+	var item *ResponseOutputItem
+	text := &bytes.Buffer{}
+	// citations are attached to every message item once it is done
+	var citations []*browser.ChatCitation
+
+	closeItem := func() error {
+		if item == nil {
+			return nil
+		}
+		index := len(resp.Output) - 1
+		switch item.Type {
+		case "reasoning":
+			part := &ResponseSummaryText{Type: "summary_text", Text: text.String()}
+			item.Summary = []*ResponseSummaryText{part}
+			if err := write("response.reasoning_summary_text.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "text": part.Text}); err != nil {
+				return err
+			}
+			if err := write("response.reasoning_summary_part.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "part": part}); err != nil {
+				return err
+			}
+		case "message":
+			part := &ResponseOutputText{Type: "output_text", Text: text.String(), Annotations: newResponseAnnotations(citations)}
+			item.Content = []*ResponseOutputText{part}
+			if err := write("response.output_text.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "text": part.Text}); err != nil {
+				return err
+			}
+			if err := write("response.content_part.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "part": part}); err != nil {
+				return err
+			}
+		}
+		item.Status = "completed"
+		if err := write("response.output_item.done", map[string]any{"output_index": index, "item": item}); err != nil {
+			return err
+		}
+		item = nil
+		text.Reset()
+		return nil
+	}
+
+	openItem := func(v *ResponseOutputItem) error {
+		if err := closeItem(); err != nil {
+			return err
+		}
+		item = v
+		resp.Output = append(resp.Output, item)
+		index := len(resp.Output) - 1
+		if err := write("response.output_item.added", map[string]any{"output_index": index, "item": item}); err != nil {
+			return err
+		}
+		switch item.Type {
+		case "reasoning":
+			return write("response.reasoning_summary_part.added", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "part": &ResponseSummaryText{Type: "summary_text"}})
+		case "message":
+			return write("response.content_part.added", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "part": &ResponseOutputText{Type: "output_text", Annotations: []any{}}})
+		}
+		return nil
+	}
+
+	writeDelta := func(typ, delta string) error {
+		if item == nil || item.Type != typ {
+			v := &ResponseOutputItem{Type: typ, Status: "in_progress"}
+			switch typ {
+			case "reasoning":
+				v.Id = fmt.Sprintf("rs_%s_%d", hdr.Id, len(resp.Output))
+			case "message":
+				v.Id, v.Role = fmt.Sprintf("msg_%s_%d", hdr.Id, len(resp.Output)), "assistant"
+			}
+			if err := openItem(v); err != nil {
+				return err
+			}
+		}
+		text.WriteString(delta)
+		index := len(resp.Output) - 1
+		if typ == "reasoning" {
+			return write("response.reasoning_summary_text.delta", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "delta": delta})
+		}
+		return write("response.output_text.delta", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "delta": delta})
+	}
+
+	if err = write("response.created", map[string]any{"response": resp}); err != nil {
+		return err
+	}
+	if err = write("response.in_progress", map[string]any{"response": resp}); err != nil {
+		return err
+	}
+
+	contentB, reasonB := &bytes.Buffer{}, &bytes.Buffer{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-hdr.Ch:
+			if !ok {
+				task.done(contentB.String())
+				return nil
+			}
+			if msg.Error != nil {
+				logger.Ctx(ctx).Error().Err(msg.Error).Msg("chat stream error")
+				resp.fail(msg.Error)
+				return write("response.failed", map[string]any{"response": resp})
+			}
+			citations = browser.MergeCitations(citations, msg.Citations...)
+			if msg.FinishReason == "" {
+				if msg.Content != "" {
+					contentB.WriteString(msg.Content)
+					delta := msg.Content
+					if tcp != nil {
+						delta = tcp.Feed(delta)
+					}
+					if delta != "" {
+						if err = writeDelta("message", delta); err != nil {
+							return err
+						}
+					}
+				} else if msg.ReasoningContent != "" {
+					reasonB.WriteString(msg.ReasoningContent)
+					if err = writeDelta("reasoning", msg.ReasoningContent); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if tcp != nil {
+				if delta := tcp.Flush(); delta != "" {
+					if err = writeDelta("message", delta); err != nil {
+						return err
+					}
+				}
+				for _, call := range tcp.Calls {
+					v := functionCallItem(call)
+					v.Status, v.Arguments = "in_progress", ""
+					if err = openItem(v); err != nil {
+						return err
+					}
+					index := len(resp.Output) - 1
+					if err = write("response.function_call_arguments.delta", map[string]any{"item_id": v.Id, "output_index": index, "delta": call.Function.Arguments}); err != nil {
+						return err
+					}
+					if err = write("response.function_call_arguments.done", map[string]any{"item_id": v.Id, "output_index": index, "arguments": call.Function.Arguments}); err != nil {
+						return err
+					}
+					v.Arguments = call.Function.Arguments
+				}
+			}
+			if err = closeItem(); err != nil {
+				return err
+			}
+
+			event := resp.finish(msg.FinishReason)
+			resp.Usage = newResponseUsage(promptN, contentB.String(), reasonB.String())
+			if err = write(event, map[string]any{"response": resp}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+func TestResponseToChatCompletionReq(t *testing.T) {
+	r, err := json.UnmarshalTo[*ResponseReq](`{
+		"model": "qwen",
+		"instructions": "be brief",
+		"input": [
+			{"role": "developer", "content": "answer in english"},
+			{"role": "user", "content": [{"type": "input_text", "text": "read both"}, {"type": "input_image", "image_url": "data:image/png;base64,AAAA"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "Read", "arguments": "{\"path\":\"a.txt\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "Read", "arguments": "{\"path\":\"b.txt\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "a"}
+		],
+		"reasoning": {"effort": "minimal"},
+		"tools": [{"type": "web_search_preview"}, {"type": "file_search"}, {"type": "function", "name": "Read", "parameters": {"type": "object"}}]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := r.toChatCompletionReq()
+	if req.Model != "qwen" || req.Search != "enabled" || req.Thinking == nil || req.Thinking.Type != "disabled" {
+		t.Fatalf("unexpected request: %s", json.MustMarshalToString(req))
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "Read" {
+		t.Errorf("unexpected tools: %s", json.MustMarshalToString(req.Tools))
+	}
+	if len(req.Messages) != 5 {
+		t.Fatalf("want 5 messages, got %s", json.MustMarshalToString(req.Messages))
+	}
+	for i, role := range []string{"system", "system", "user", "assistant", "tool"} {
+		if req.Messages[i].Role != role {
+			t.Errorf("message %d: want role %s, got %s", i, role, req.Messages[i].Role)
+		}
+	}
+	if m := req.Messages[2]; len(m.Content.ListValue) != 2 || m.Content.ListValue[1].ImageURL.URL != "data:image/png;base64,AAAA" {
+		t.Errorf("unexpected user message: %s", json.MustMarshalToString(m))
+	}
+	if m := req.Messages[3]; len(m.ToolCalls) != 2 || m.ToolCalls[1].Function.Arguments != `{"path":"b.txt"}` {
+		t.Errorf("consecutive calls should share the assistant message: %s", json.MustMarshalToString(m))
+	}
+	if m := req.Messages[4]; m.ToolCallId != "call_1" || m.Content.Text() != "a" {
+		t.Errorf("unexpected tool message: %s", json.MustMarshalToString(m))
+	}
+
+	r = &ResponseReq{Model: "qwen", Input: &ResponseInput{StringValue: "hi"}, Reasoning: &ResponseReasoning{Effort: "high"}}
+	req = r.toChatCompletionReq()
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Thinking.Type != "enabled" {
+		t.Errorf("unexpected request: %s", json.MustMarshalToString(req))
+	}
+}
+
+func TestResponseResp(t *testing.T) {
+	for reason, want := range map[string]string{browser.FinishStop: "completed", "tool_calls": "completed", browser.FinishLength: "incomplete", browser.FinishContentFilter: "incomplete"} {
+		r := &ResponseResp{}
+		if event := r.finish(reason); r.Status != want || event != "response."+want {
+			t.Errorf("finish %s: want %s, got %s %s", reason, want, r.Status, event)
+		}
+	}
+	r := &ResponseResp{}
+	r.finish(browser.FinishLength)
+	if r.IncompleteDetails == nil || r.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("unexpected incomplete details: %+v", r.IncompleteDetails)
+	}
+
+	r = &ResponseResp{}
+	r.fail(errx.TooManyRequests().WithMsgf("busy"))
+	if r.Status != "failed" || r.Error.Code != "rate_limit_exceeded" || r.Error.Message != "busy" {
+		t.Errorf("unexpected failure: %s %+v", r.Status, r.Error)
+	}
+
+	item := functionCallItem(&ChatCompletionToolCall{Id: "call_1", Function: &ChatCompletionToolCallFunction{Name: "Read", Arguments: `{"path":"a.txt"}`}})
+	if item.Type != "function_call" || item.Id != "fc_call_1" || item.CallId != "call_1" || item.Status != "completed" {
+		t.Errorf("unexpected function call item: %s", json.MustMarshalToString(item))
+	}
+}
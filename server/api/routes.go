@@ -20,6 +20,7 @@ import (
 //	@tag.name					common
 //	@tag.name					model
 //	@tag.name					chat
+//	@tag.name					admin
 //	@accept						json
 //	@produce					json
 //	@schemes					http
@@ -32,7 +33,29 @@ func setupRoutes(app *echo.Echo) {
 	v1 := app.Group("/v1", echox.MiddlewareLogger(), mdAuth())
 	{
 		v1.GET("/models", hdrModels)
+		v1.GET("/providers", hdrProviders)
 		v1.POST("/chat/completions", hdrChatCompletions)
+		v1.POST("/messages", hdrMessages)
+		v1.POST("/responses", hdrResponses)
+	}
+
+	// the logger keeps the whole bodies, so it is left out of the endless login stream, the login actions with phone
+	// numbers and sms codes, the storage states with cookies and the debug files
+	mdLogger := echox.MiddlewareLogger()
+	admin := app.Group("/admin", mdAdminAuth())
+	{
+		admin.POST("/logins", hdrStartLogin, mdLogger)
+		admin.GET("/logins/:id/screenshot", hdrLoginScreenshot, mdLogger)
+		admin.GET("/logins/:id/stream", hdrLoginStream)
+		admin.GET("/logins/:id/qrcode", hdrLoginQRCode, mdLogger)
+		admin.POST("/logins/:id/actions", hdrLoginAction)
+		admin.DELETE("/logins/:id", hdrFinishLogin, mdLogger)
+		admin.GET("/states/:model", hdrExportState)
+		admin.PUT("/states/:model", hdrImportState)
+		admin.GET("/selectors", hdrSelectors, mdLogger)
+		admin.GET("/queues", hdrQueues, mdLogger)
+		admin.GET("/debug", hdrDebugCaptures, mdLogger)
+		admin.GET("/debug/:id/:file", hdrDebugFile)
 	}
 }
 
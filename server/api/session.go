@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+)
+
+type chatSession struct {
+	// Model is the resolved model, an alias may route the same request to another one next time
+	Model   string
+	Account string
+	URL     string
+}
+
+var chatSessions, _ = lru.New[string, *chatSession](1024)
+
+// chatSessionKey hashes the model with the role, text and tool calls of every message, so any edit of the history is a miss
+func chatSessionKey(model string, messages []*ChatCompletionMessage) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	for _, message := range messages {
+		h.Write([]byte{0})
+		h.Write([]byte(message.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.TrimSpace(message.Content.Text())))
+		// the ids are made up by the proxy, the calls are told apart by their name and arguments
+		for _, call := range message.ToolCalls {
+			h.Write([]byte{0})
+			h.Write([]byte(renderToolCall(call)))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findChatSession looks up the conversation matching the history before the last assistant message,
+// and returns the new messages to send in it
+func findChatSession(req *ChatCompletionReq, account string) (*chatSession, []*ChatCompletionMessage) {
+	i := len(req.Messages) - 1
+	for ; i >= 0; i-- {
+		if req.Messages[i].Role == "assistant" {
+			break
+		}
+	}
+	if i < 0 || i == len(req.Messages)-1 {
+		return nil, nil
+	}
+	session, ok := chatSessions.Get(chatSessionKey(req.Model, req.Messages[:i+1]))
+	if !ok || (account != "" && session.Account != account) {
+		return nil, nil
+	}
+	return session, req.Messages[i+1:]
+}
+
+// saveChatSession keeps the conversation of hdr under the history ending with the answer as the client got it
+func saveChatSession(req *ChatCompletionReq, hdr *browser.ChatHandler, content string) {
+	if hdr.URL == "" || hdr.URL == "about:blank" {
+		return
+	}
+	answer := &ChatCompletionMessage{Role: "assistant", Content: &ChatCompletionMessageContent{StringValue: content}}
+	if len(req.Tools) > 0 {
+		// the client gets the text without the tool call markup and the calls apart, and sends them back so
+		tcp := &toolCallParser{}
+		answer.Content.StringValue = tcp.Feed(content) + tcp.Flush()
+		answer.ToolCalls = tcp.Calls
+	}
+	messages := append(req.Messages[:len(req.Messages):len(req.Messages)], answer)
+	chatSessions.Add(chatSessionKey(req.Model, messages), &chatSession{Model: hdr.Model, Account: hdr.Account, URL: hdr.URL})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/browser"
+)
+
+func TestChatSession(t *testing.T) {
+	msg := func(role, text string) *ChatCompletionMessage {
+		return &ChatCompletionMessage{Role: role, Content: &ChatCompletionMessageContent{StringValue: text}}
+	}
+
+	req1 := &ChatCompletionReq{Model: "test", Messages: []*ChatCompletionMessage{msg("system", "hello"), msg("user", "world1")}}
+	if session, _ := findChatSession(req1, ""); session != nil {
+		t.Fatalf("want no session for the first turn, got %#v", session)
+	}
+	saveChatSession(req1, &browser.ChatHandler{Account: "user0", URL: "https://example.com/chat/1"}, "world2")
+
+	req2 := &ChatCompletionReq{Model: "test", Messages: append(req1.Messages, msg("assistant", "world2 "), msg("user", "world3"))}
+	session, messages := findChatSession(req2, "")
+	if session == nil || session.URL != "https://example.com/chat/1" {
+		t.Fatalf("want session, got %#v", session)
+	}
+	if len(messages) != 1 || messages[0].Content.Text() != "world3" {
+		t.Fatalf("want only the new user message, got %d", len(messages))
+	}
+
+	if session, _ = findChatSession(req2, "user1"); session != nil {
+		t.Fatalf("want no session for another account, got %#v", session)
+	}
+
+	req3 := &ChatCompletionReq{Model: "test", Messages: []*ChatCompletionMessage{msg("system", "hello"), msg("user", "world0"), msg("assistant", "world2"), msg("user", "world3")}}
+	if session, _ = findChatSession(req3, ""); session != nil {
+		t.Fatalf("want no session for a diverged history, got %#v", session)
+	}
+
+	// the client sends the answer back without the markup, with the calls apart and the arguments reformatted
+	tools := []*ChatCompletionTool{{Type: "function", Function: &ChatCompletionToolFunction{Name: "Bash"}}}
+	req4 := &ChatCompletionReq{Model: "test", Tools: tools, Messages: []*ChatCompletionMessage{msg("user", "list files")}}
+	saveChatSession(req4, &browser.ChatHandler{Account: "user0", URL: "https://example.com/chat/2"}, "好的"+toolCallOpen+"\n"+`{"name":"Bash","arguments":{"command":"ls","timeout":1}}`+"\n"+toolCallClose)
+
+	answer := msg("assistant", "好的")
+	answer.ToolCalls = []*ChatCompletionToolCall{{Id: "call_1", Type: "function", Function: &ChatCompletionToolCallFunction{Name: "Bash", Arguments: `{"timeout": 1, "command": "ls"}`}}}
+	result := &ChatCompletionMessage{Role: "tool", ToolCallId: "call_1", Content: &ChatCompletionMessageContent{StringValue: "go.mod"}}
+	req5 := &ChatCompletionReq{Model: "test", Tools: tools, Messages: []*ChatCompletionMessage{msg("user", "list files"), answer, result}}
+	session, messages = findChatSession(req5, "")
+	if session == nil || session.URL != "https://example.com/chat/2" {
+		t.Fatalf("want session after a tool call, got %#v", session)
+	}
+	if len(messages) != 1 || messages[0].Role != "tool" {
+		t.Fatalf("want only the tool result, got %d", len(messages))
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/starudream/aichat-proxy/server/config"
 	"github.com/starudream/aichat-proxy/server/internal/echox"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
 	"github.com/starudream/aichat-proxy/server/internal/osx"
 	"github.com/starudream/aichat-proxy/server/logger"
 )
@@ -24,6 +25,36 @@ import (
 type Ctx = echo.Context
 
 func Start(ctx context.Context, wg *sync.WaitGroup) {
+	app := newApp()
+
+	ln, err := net.Listen("tcp", config.G().ServerAddr)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("http server listen error")
+	}
+	app.Listener = ln
+
+	go func() {
+		logger.Info().Str("addr", ln.Addr().String()).Msg("http server starting")
+		err = app.Start(config.G().ServerAddr)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal().Err(err).Msg("http server run error")
+		}
+	}()
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		logger.Warn().Msg("http server stopping")
+		_ctx, _cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer _cancel()
+		_ = app.Shutdown(_ctx)
+		logger.Info().Msg("http server stopped")
+	}()
+}
+
+func newApp() *echo.Echo {
 	app := echo.New()
 	app.HideBanner = true
 	app.HidePort = true
@@ -49,31 +80,14 @@ func Start(ctx context.Context, wg *sync.WaitGroup) {
 	setupRoutes(app)
 	setupSwagger(app)
 
-	ln, err := net.Listen("tcp", config.G().ServerAddr)
-	if err != nil {
-		logger.Fatal().Err(err).Msg("http server listen error")
-	}
-	app.Listener = ln
-
-	go func() {
-		logger.Info().Str("addr", ln.Addr().String()).Msg("http server starting")
-		err = app.Start(config.G().ServerAddr)
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatal().Err(err).Msg("http server run error")
-		}
-	}()
+	return app
+}
 
-	wg.Add(1)
+const ctxKeyApiKey = "apiKey"
 
-	go func() {
-		defer wg.Done()
-		<-ctx.Done()
-		logger.Warn().Msg("http server stopping")
-		_ctx, _cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer _cancel()
-		_ = app.Shutdown(_ctx)
-		logger.Info().Msg("http server stopped")
-	}()
+func apiKey(c echo.Context) string {
+	key, _ := c.Get(ctxKeyApiKey).(string)
+	return key
 }
 
 func mdAuth() echo.MiddlewareFunc {
@@ -88,11 +102,36 @@ func mdAuth() echo.MiddlewareFunc {
 		}
 	}
 	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		// x-api-key is used by anthropic clients
+		KeyLookup: "header:" + echo.HeaderAuthorization + ":Bearer ,header:X-Api-Key",
 		Validator: func(key string, c echo.Context) (bool, error) {
 			_, ok := keys[key]
 			if !ok {
 				return false, fmt.Errorf("invalid api key")
 			}
+			c.Set(ctxKeyApiKey, key)
+			return true, nil
+		},
+	})
+}
+
+func mdAdminAuth() echo.MiddlewareFunc {
+	keys := map[string]struct{}{}
+	for _, v := range config.G().AdminKeys {
+		keys[v] = struct{}{}
+	}
+	if len(keys) == 0 {
+		logger.Warn().Msg("admin api disabled")
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error { return errx.Forbidden().WithMsgf("admin api disabled") }
+		}
+	}
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:" + echo.HeaderAuthorization + ":Bearer ,header:X-Api-Key",
+		Validator: func(key string, c echo.Context) (bool, error) {
+			if _, ok := keys[key]; !ok {
+				return false, fmt.Errorf("invalid admin key")
+			}
 			return true, nil
 		},
 	})
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+const (
+	toolCallOpen  = "<tool_call>"
+	toolCallClose = "</tool_call>"
+)
+
+const toolCallInstruction = `【工具调用】
+如需调用工具，请按以下格式输出，每个工具调用一个块，调用工具时不要输出其他内容：
+<tool_call>
+{"name": "工具名称", "arguments": {"参数名": "参数值"}}
+</tool_call>
+工具的执行结果会在下一轮以【工具】消息返回。`
+
+type ChatCompletionToolCall struct {
+	// 索引（仅流式）
+	Index *int `json:"index,omitempty"`
+	// 工具调用 Id
+	Id string `json:"id,omitempty"`
+	// 类型，固定为 function
+	Type string `json:"type,omitempty"`
+	// 函数调用
+	Function *ChatCompletionToolCallFunction `json:"function,omitempty"`
+}
+
+type ChatCompletionToolCallFunction struct {
+	// 函数名称
+	Name string `json:"name,omitempty"`
+	// 参数，JSON 字符串
+	Arguments string `json:"arguments"`
+}
+
+type toolCallText struct {
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments"`
+}
+
+// renderToolCall renders an assistant tool call back into the format of toolCallInstruction
+func renderToolCall(call *ChatCompletionToolCall) string {
+	if call == nil || call.Function == nil {
+		return ""
+	}
+	v := &toolCallText{Name: call.Function.Name, Arguments: call.Function.Arguments}
+	if args, err := json.UnmarshalTo[any](call.Function.Arguments); err == nil {
+		v.Arguments = args
+	}
+	return toolCallOpen + "\n" + json.MustMarshalCanonical(v) + "\n" + toolCallClose
+}
+
+func parseToolCall(s string) *ChatCompletionToolCall {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	v, err := json.UnmarshalTo[*toolCallText](strings.TrimSpace(s))
+	if err != nil || v == nil || v.Name == "" {
+		return nil
+	}
+	args, ok := v.Arguments.(string)
+	if !ok {
+		if v.Arguments == nil {
+			v.Arguments = map[string]any{}
+		}
+		args = json.MustMarshalToString(v.Arguments)
+	}
+	return &ChatCompletionToolCall{
+		Id:   "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24],
+		Type: "function",
+		Function: &ChatCompletionToolCallFunction{
+			Name:      v.Name,
+			Arguments: args,
+		},
+	}
+}
+
+// toolCallParser splits the model output into plain text and tool calls,
+// text that may be the beginning of a tool call is held back until it is decided
+type toolCallParser struct {
+	pending string
+	inCall  bool
+
+	Calls []*ChatCompletionToolCall
+}
+
+// Feed returns the text that is safe to emit
+func (p *toolCallParser) Feed(s string) string {
+	p.pending += s
+	out := &strings.Builder{}
+	for {
+		if p.inCall {
+			i := strings.Index(p.pending, toolCallClose)
+			if i < 0 {
+				break
+			}
+			if call := parseToolCall(p.pending[:i]); call != nil {
+				p.Calls = append(p.Calls, call)
+			} else {
+				out.WriteString(toolCallOpen + p.pending[:i+len(toolCallClose)])
+			}
+			p.pending, p.inCall = p.pending[i+len(toolCallClose):], false
+			continue
+		}
+		i := strings.Index(p.pending, toolCallOpen)
+		if i >= 0 {
+			out.WriteString(p.pending[:i])
+			p.pending, p.inCall = p.pending[i+len(toolCallOpen):], true
+			continue
+		}
+		n := len(p.pending)
+		for k := min(len(toolCallOpen)-1, n); k > 0; k-- {
+			if strings.HasPrefix(toolCallOpen, p.pending[n-k:]) {
+				n -= k
+				break
+			}
+		}
+		out.WriteString(p.pending[:n])
+		p.pending = p.pending[n:]
+		break
+	}
+	return out.String()
+}
+
+// Flush returns the held back text, an unclosed tool call is parsed as is
+func (p *toolCallParser) Flush() string {
+	s := p.pending
+	p.pending = ""
+	if p.inCall {
+		p.inCall = false
+		if call := parseToolCall(s); call != nil {
+			p.Calls = append(p.Calls, call)
+			return ""
+		}
+		return toolCallOpen + s
+	}
+	return s
+}
+
+func (p *toolCallParser) FinishReason() string {
+	if len(p.Calls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestToolCallParser(t *testing.T) {
+	p := &toolCallParser{}
+	out := ""
+	for _, s := range []string{"好的，", "我来执行<tool", "_call>\n{\"name\": \"Bash\", ", "\"arguments\": {\"command\": \"ls\"}}\n</tool_", "call>\n<tool_call>{\"name\":\"Read\",\"arguments\":\"{\\\"path\\\":\\\"a.txt\\\"}\"}"} {
+		out += p.Feed(s)
+	}
+	out += p.Flush()
+	if out != "好的，我来执行\n" {
+		t.Fatalf("unexpected text: %q", out)
+	}
+	if len(p.Calls) != 2 {
+		t.Fatalf("want 2 tool calls, got %d", len(p.Calls))
+	}
+	if p.Calls[0].Function.Name != "Bash" || p.Calls[0].Function.Arguments != `{"command":"ls"}` {
+		t.Fatalf("unexpected tool call 0: %#v", p.Calls[0].Function)
+	}
+	if p.Calls[1].Function.Name != "Read" || p.Calls[1].Function.Arguments != `{"path":"a.txt"}` {
+		t.Fatalf("unexpected tool call 1: %#v", p.Calls[1].Function)
+	}
+	if p.FinishReason() != "tool_calls" {
+		t.Fatalf("unexpected finish reason: %s", p.FinishReason())
+	}
+
+	p = &toolCallParser{}
+	out = p.Feed("a < b, <tool_call>not json</tool_call>") + p.Flush()
+	if out != "a < b, <tool_call>not json</tool_call>" || len(p.Calls) != 0 {
+		t.Fatalf("unexpected text: %q, calls: %d", out, len(p.Calls))
+	}
+}
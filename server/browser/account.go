@@ -0,0 +1,122 @@
+package browser
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// account is one persistent browser context, with its own profile directory and cookie jar
+type account struct {
+	b *Browser
+
+	name string
+	path string
+
+	bc playwright.BrowserContext
+
+	pools map[string]*pagePool
+	owned map[playwright.Page]struct{}
+
+	mu sync.Mutex
+	// traceMu is held by the chat whose trace chunk is being recorded
+	traceMu sync.Mutex
+}
+
+func newAccount(b *Browser, name string) *account {
+	acc := &account{
+		b:     b,
+		name:  name,
+		path:  filepath.Join(config.UserdataPath, name),
+		pools: map[string]*pagePool{},
+		owned: map[playwright.Page]struct{}{},
+	}
+	for _, m := range handlerNames() {
+		acc.pools[m] = newPagePool(acc, m, chatHandlers[m]().URL())
+	}
+	return acc
+}
+
+func (s *account) launchBrowser() {
+	log := logger.With().Str("account", s.name).Logger()
+	log.Info().Msg("wait for browser ready, may take a few seconds")
+	var err error
+	s.bc, err = s.b.pw.Firefox.LaunchPersistentContext(s.path, playwright.BrowserTypeLaunchPersistentContextOptions{
+		ExecutablePath:    playwright.String(s.b.co.ExecutablePath),
+		Headless:          playwright.Bool(s.b.co.Headless),
+		Args:              s.b.co.Args,
+		Env:               s.b.co.Env,
+		Proxy:             s.b.co.PWProxy(),
+		FirefoxUserPrefs:  s.b.co.FirefoxUserPrefs,
+		BypassCSP:         playwright.Bool(true),
+		IgnoreHttpsErrors: playwright.Bool(true),
+		AcceptDownloads:   playwright.Bool(true),
+		DownloadsPath:     playwright.String(config.DownloadsPath),
+		Timeout:           playwright.Float(60 * 1000),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("playwright launch persistent context error")
+	}
+	s.bc.SetDefaultTimeout(10 * 1000)
+	s.startTracing()
+	log.Info().Msg("browser ready")
+}
+
+func (s *account) claimPage(url string) (page playwright.Page, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for owned := range s.owned {
+		if owned.IsClosed() {
+			delete(s.owned, owned)
+		}
+	}
+
+	pages := s.bc.Pages()
+	for i := range pages {
+		if _, ok := s.owned[pages[i]]; ok {
+			continue
+		}
+		if strings.HasPrefix(pages[i].URL(), url) || pages[i].URL() == "about:blank" {
+			page = pages[i]
+			break
+		}
+	}
+
+	if page == nil {
+		page, err = s.bc.NewPage()
+		if err != nil {
+			if errors.Is(err, playwright.ErrTargetClosed) {
+				logger.Warn().Str("account", s.name).Msg("detected browser closed, restart browser")
+				s.launchBrowser()
+				page = s.bc.Pages()[0]
+			} else {
+				logger.Error().Err(err).Str("account", s.name).Msg("open new page error")
+				return nil, err
+			}
+		}
+	}
+
+	s.owned[page] = struct{}{}
+
+	return page, nil
+}
+
+// openPage opens a tab that is never claimed by the page pools, the caller closes it when done
+func (s *account) openPage() (playwright.Page, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, err := s.bc.NewPage()
+	if err != nil {
+		logger.Error().Err(err).Str("account", s.name).Msg("open new page error")
+		return nil, err
+	}
+	s.owned[page] = struct{}{}
+	return page, nil
+}
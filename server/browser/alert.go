@@ -0,0 +1,82 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+func captchaError(model, account string) error {
+	return errx.ServiceUnavailable().WithCode(errx.CodeCaptcha).
+		WithMsgf("model %s requires human verification", model).
+		WithMetadata(map[string]any{"model": model, "account": account})
+}
+
+// Alert is posted as json to the alert webhook
+type Alert struct {
+	// Event is captcha for now
+	Event   string `json:"event"`
+	Model   string `json:"model"`
+	Account string `json:"account"`
+	URL     string `json:"url"`
+	Message string `json:"message"`
+	Time    int64  `json:"time"`
+	// Screenshot is the png of the page, base64 encoded by json
+	Screenshot []byte `json:"screenshot,omitempty"`
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertCaptcha posts the page screenshot to the alert webhook, so someone can solve the captcha over vnc
+func (p *pagePool) alertCaptcha(log logger.ZLogger, page playwright.Page) {
+	log.Warn().Msg("captcha detected, provider blocked")
+	webhook := config.G().AlertWebhook
+	if webhook == "" {
+		return
+	}
+	alert := &Alert{
+		Event:   "captcha",
+		Model:   p.name,
+		Account: p.acc.name,
+		URL:     page.URL(),
+		Message: "model " + p.name + " of account " + p.acc.name + " requires human verification",
+		Time:    time.Now().Unix(),
+	}
+	// the screenshot is taken now, the page is reset right after
+	bs, err := page.Screenshot(playwright.PageScreenshotOptions{Type: playwright.ScreenshotTypePng})
+	if err != nil {
+		log.Error().Err(err).Msg("alert screenshot error")
+	}
+	alert.Screenshot = bs
+	go sendAlert(log, webhook, alert)
+}
+
+func sendAlert(log logger.ZLogger, webhook string, alert *Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(json.MustMarshal(alert)))
+	if err != nil {
+		log.Error().Err(err).Msg("new alert request error")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Msg("send alert error")
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Error().Msgf("send alert error: status %d", resp.StatusCode)
+		return
+	}
+	log.Info().Msgf("alert %s sent", alert.Event)
+}
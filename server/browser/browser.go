@@ -2,14 +2,15 @@ package browser
 
 import (
 	"context"
-	"errors"
 	"log/slog"
-	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/playwright-community/playwright-go"
 
 	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
 	"github.com/starudream/aichat-proxy/server/internal/writer"
 	"github.com/starudream/aichat-proxy/server/logger"
 )
@@ -25,14 +26,21 @@ type Browser struct {
 	co *CamoufoxOptions
 
 	pw *playwright.Playwright
-	bc playwright.BrowserContext
 
-	mu sync.Mutex
+	accounts []*account
+	rr       atomic.Uint64
 }
 
 func startBrowser(ctx context.Context, wg *sync.WaitGroup) {
 	var err error
 
+	// a key pinned to a missing account would fail every request, the key itself is not logged
+	for _, name := range config.G().ApiKeyAccounts {
+		if !slices.Contains(config.G().BrowserAccounts, name) {
+			logger.Fatal().Msgf("api key pinned to unknown browser account: %s", name)
+		}
+	}
+
 	b = &Browser{}
 
 	b.cp = &CamoufoxParams{}
@@ -42,7 +50,17 @@ func startBrowser(ctx context.Context, wg *sync.WaitGroup) {
 	}
 
 	b.runPlaywright()
-	b.launchBrowser()
+
+	for _, name := range config.G().BrowserAccounts {
+		acc := newAccount(b, name)
+		acc.launchBrowser()
+		b.accounts = append(b.accounts, acc)
+	}
+	if len(b.accounts) == 0 {
+		logger.Fatal().Msg("no browser account configured")
+	}
+
+	go b.checkLoop(ctx)
 
 	wg.Add(1)
 
@@ -50,7 +68,9 @@ func startBrowser(ctx context.Context, wg *sync.WaitGroup) {
 		defer wg.Done()
 		<-ctx.Done()
 		logger.Warn().Msg("browser closing")
-		_ = b.bc.Close()
+		for _, acc := range b.accounts {
+			_ = acc.bc.Close()
+		}
 		logger.Info().Msg("browser closed")
 	}()
 }
@@ -71,80 +91,37 @@ func (s *Browser) runPlaywright() {
 	logger.Info().Msg("playwright ready")
 }
 
-func (s *Browser) launchBrowser() {
-	logger.Info().Msg("wait for browser ready, may take a few seconds")
-	var err error
-	b.bc, err = b.pw.Firefox.LaunchPersistentContext(config.Userdata0Path, playwright.BrowserTypeLaunchPersistentContextOptions{
-		ExecutablePath:    playwright.String(b.co.ExecutablePath),
-		Headless:          playwright.Bool(b.co.Headless),
-		Args:              b.co.Args,
-		Env:               b.co.Env,
-		Proxy:             b.co.PWProxy(),
-		FirefoxUserPrefs:  b.co.FirefoxUserPrefs,
-		BypassCSP:         playwright.Bool(true),
-		IgnoreHttpsErrors: playwright.Bool(true),
-		AcceptDownloads:   playwright.Bool(true),
-		DownloadsPath:     playwright.String(config.DownloadsPath),
-		Timeout:           playwright.Float(60 * 1000),
-	})
-	if err != nil {
-		logger.Fatal().Err(err).Msg("playwright launch persistent context error")
+// getAccount returns the named account, or the first one when name is empty
+func (s *Browser) getAccount(name string) (*account, error) {
+	if name == "" {
+		return s.accounts[0], nil
 	}
-	b.bc.SetDefaultTimeout(10 * 1000)
-	logger.Info().Msg("browser ready")
-}
-
-func (s *Browser) openPage(url string) (page playwright.Page, err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	pages := s.bc.Pages()
-	for i := range pages {
-		if pages[i].URL() == url {
-			return pages[i], nil
-		}
-		if strings.HasPrefix(pages[i].URL(), url) || pages[i].URL() == "about:blank" {
-			page = pages[i]
-			break
-		}
-	}
-
-	if page == nil {
-		page, err = s.bc.NewPage()
-		if err != nil {
-			if errors.Is(err, playwright.ErrTargetClosed) {
-				logger.Warn().Msg("detected browser closed, restart browser")
-				s.launchBrowser()
-				page = s.bc.Pages()[0]
-			} else {
-				logger.Error().Err(err).Msg("open new page error")
-				return nil, err
-			}
+	for _, acc := range s.accounts {
+		if acc.name == name {
+			return acc, nil
 		}
 	}
-
-	_, err = page.Goto(url, playwright.PageGotoOptions{
-		Timeout:   playwright.Float(30 * 1000),
-		WaitUntil: playwright.WaitUntilStateLoad,
-	})
-	if err != nil {
-		logger.Error().Err(err).Msg("page goto error")
-		return nil, err
-	}
-
-	logger.Info().Msgf("page goto %q ready", url)
-
-	return page, nil
+	return nil, errx.NotFound().WithMsgf("account not found: %s", name)
 }
 
-func (s *Browser) resetPages(url string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	pages := s.bc.Pages()
-	for i := range pages {
-		if strings.HasPrefix(pages[i].URL(), url) {
-			_, _ = pages[i].Goto("about:blank")
+// pickAccount returns the pinned account, or the least busy one for the model that is not blocked by a captcha,
+// the queued requests count as busy, ties are broken in round-robin order
+func (s *Browser) pickAccount(model, pinned string) (*account, error) {
+	if pinned != "" {
+		return s.getAccount(pinned)
+	}
+	start := int(s.rr.Add(1) % uint64(len(s.accounts)))
+	var picked *account
+	for i := range s.accounts {
+		acc := s.accounts[(start+i)%len(s.accounts)]
+		if picked == nil {
+			picked = acc
+			continue
+		}
+		ab, pb := acc.pools[model].status.blocked(), picked.pools[model].status.blocked()
+		if (pb && !ab) || (pb == ab && acc.pools[model].load() < picked.pools[model].load()) {
+			picked = acc
 		}
 	}
+	return picked, nil
 }
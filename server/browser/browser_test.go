@@ -0,0 +1,31 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+)
+
+func TestPickAccount(t *testing.T) {
+	s := &Browser{}
+	s.accounts = []*account{newAccount(s, "user0"), newAccount(s, "user1")}
+
+	if err := s.accounts[0].pools["kimi"].wait(context.Background(), PriorityNormal, nil); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if acc, err := s.pickAccount("kimi", ""); err != nil || acc.name != "user1" {
+			t.Fatalf("expect the idle account, got %v %v", acc, err)
+		}
+	}
+	if acc, err := s.pickAccount("kimi", "user0"); err != nil || acc.name != "user0" {
+		t.Fatalf("expect the pinned account, got %v %v", acc, err)
+	}
+
+	var ee *errx.Error
+	if _, err := s.pickAccount("kimi", "unknown"); !errors.As(err, &ee) || ee.Status != 404 {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
@@ -11,7 +11,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatBaiduHandler{})
+	registerChatHandler(func() chatHandler { return &chatBaiduHandler{} })
 }
 
 type chatBaiduHandler struct {
@@ -19,6 +19,7 @@ type chatBaiduHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
+	spec *HandlerSpec
 }
 
 func (h *chatBaiduHandler) Name() string {
@@ -32,41 +33,29 @@ func (h *chatBaiduHandler) URL() string {
 func (h *chatBaiduHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatBaiduHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for chat editor")
-	locEditor := h.page.Locator("div.yc-editor")
-	if err = locEditor.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat editor error")
-		return err
-	}
+func (h *chatBaiduHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("fill prompt to chat editor")
-	if err = locEditor.Fill(prompt); err != nil {
-		logger.Error().Err(err).Msg("fill prompt to chat editor error")
-		return err
+func (h *chatBaiduHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatBaiduHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
 }
 
 func (h *chatBaiduHandler) Send() error {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.page.Locator(`div[class^="send_"]`)
-	if err := locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
-
-	h.log.Debug().Msg("click chat send button")
-	if err := locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
-
-	return nil
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type baiduEvent struct {
@@ -79,6 +68,13 @@ type baiduEvent struct {
 	Data struct {
 		Content string `json:"content,omitempty"`
 		// IsEnd   int    `json:"is_end"`
+		// search
+		SearchCitations struct {
+			List []struct {
+				Title string `json:"title"`
+				URL   string `json:"url"`
+			} `json:"list,omitempty"`
+		} `json:"searchCitations,omitempty"`
 	} `json:"data,omitempty"`
 }
 
@@ -98,6 +94,12 @@ func (h *chatBaiduHandler) Unmarshal(s string) *ChatMessage {
 		return &ChatMessage{ReasoningContent: event.Thoughts}
 	} else if event.Data.Content != "" {
 		return &ChatMessage{Content: event.Data.Content}
+	} else if len(event.Data.SearchCitations.List) > 0 {
+		msg := &ChatMessage{}
+		for _, v := range event.Data.SearchCitations.List {
+			msg.Citations = MergeCitations(msg.Citations, &ChatCitation{Title: v.Title, URL: v.URL})
+		}
+		return msg
 	}
 	return nil
 }
@@ -11,7 +11,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatDeepseekHandler{})
+	registerChatHandler(func() chatHandler { return &chatDeepseekHandler{} })
 }
 
 type chatDeepseekHandler struct {
@@ -19,6 +19,7 @@ type chatDeepseekHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
+	spec *HandlerSpec
 
 	reasoning atomic.Bool
 }
@@ -34,63 +35,89 @@ func (h *chatDeepseekHandler) URL() string {
 func (h *chatDeepseekHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatDeepseekHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("click start new conversation")
-	if err = h.page.GetByText("开启新对话").Click(); err != nil {
-		h.log.Error().Err(err).Msg("click start new conversation error")
-		return err
-	}
-
-	h.log.Debug().Msg("wait for chat main")
-	locChat := h.page.GetByRole(*playwright.AriaRoleTextbox, playwright.PageGetByRoleOptions{Name: "给 DeepSeek 发送消息"})
-	if err = locChat.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
+func (h *chatDeepseekHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("wait for chat textarea")
-	if err = locChat.Fill(prompt); err != nil {
-		h.log.Error().Err(err).Msg("fill prompt error")
-		return err
+func (h *chatDeepseekHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatDeepseekHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "deep think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
 }
 
-func (h *chatDeepseekHandler) Send() (err error) {
-	h.log.Debug().Msg("click send")
-	if err = h.page.GetByRole(*playwright.AriaRoleButton, playwright.PageGetByRoleOptions{}).Nth(4).Click(); err != nil {
-		h.log.Error().Err(err).Msg("click send error")
-		return err
-	}
+func (h *chatDeepseekHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	return nil
+func (h *chatDeepseekHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type deepseekEvent struct {
 	V any    `json:"v"`
 	P string `json:"p,omitempty"`
 	O string `json:"o,omitempty"`
+	// error/rate_limit, set in the hint events
+	Type    string `json:"type,omitempty"`
+	Content string `json:"content,omitempty"`
 }
 
 type deepseekV struct {
 	Id int `json:"id,omitempty"`
-	// THINK or RESPONSE
+	// THINK, RESPONSE or SEARCH
 	Type    string `json:"type,omitempty"`
 	Content string `json:"content,omitempty"`
+	// SEARCH
+	Results []*deepseekResult `json:"results,omitempty"`
 
 	Response struct {
 		Fragments []struct {
-			Id      int    `json:"id"`
-			Type    string `json:"type"`
-			Content string `json:"content"`
+			Id      int               `json:"id"`
+			Type    string            `json:"type"`
+			Content string            `json:"content"`
+			Results []*deepseekResult `json:"results,omitempty"`
 		} `json:"fragments"`
 	} `json:"response"`
 }
 
+type deepseekResult struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+func deepseekCitations(results []*deepseekResult) *ChatMessage {
+	msg := &ChatMessage{}
+	for _, v := range results {
+		msg.Citations = MergeCitations(msg.Citations, &ChatCitation{Title: v.Title, URL: v.URL})
+	}
+	if len(msg.Citations) == 0 {
+		return nil
+	}
+	return msg
+}
+
+// deepseekFinish maps the final status of the response, FINISHED is the normal end
+func deepseekFinish(status string) *ChatMessage {
+	switch status {
+	case "INCOMPLETE":
+		return &ChatMessage{FinishReason: FinishLength}
+	case "CONTENT_FILTER":
+		return &ChatMessage{FinishReason: FinishContentFilter}
+	}
+	return nil
+}
+
 func (h *chatDeepseekHandler) Unmarshal(s string) *ChatMessage {
 	s = strings.TrimPrefix(s, "data:")
 	if s == "" {
@@ -100,11 +127,29 @@ func (h *chatDeepseekHandler) Unmarshal(s string) *ChatMessage {
 	if err != nil {
 		return nil
 	}
+	switch event.Type {
+	case "error", "rate_limit":
+		return upstreamError(h.Name(), event.Type, event.Content)
+	}
 	content := ""
 	switch x := event.V.(type) {
 	case string:
+		if event.P == "response/status" {
+			return deepseekFinish(x)
+		}
+		// other paths set fields like the status, a string without path appends to the last content
+		if event.P != "" && !strings.HasSuffix(event.P, "/content") {
+			return nil
+		}
 		content = x
 	case []any:
+		if strings.HasSuffix(event.P, "/results") {
+			v, e := json.UnmarshalTo[[]*deepseekResult](json.MustMarshal(x))
+			if e != nil {
+				return nil
+			}
+			return deepseekCitations(v)
+		}
 		v, e := json.UnmarshalTo[[]*deepseekV](json.MustMarshal(x))
 		if e != nil || len(v) == 0 {
 			return nil
@@ -114,6 +159,8 @@ func (h *chatDeepseekHandler) Unmarshal(s string) *ChatMessage {
 			h.reasoning.Store(true)
 		case "RESPONSE":
 			h.reasoning.Store(false)
+		case "SEARCH":
+			return deepseekCitations(v[0].Results)
 		default:
 			return nil
 		}
@@ -132,6 +179,8 @@ func (h *chatDeepseekHandler) Unmarshal(s string) *ChatMessage {
 			h.reasoning.Store(true)
 		case "RESPONSE":
 			h.reasoning.Store(false)
+		case "SEARCH":
+			return deepseekCitations(fragment.Results)
 		default:
 			return nil
 		}
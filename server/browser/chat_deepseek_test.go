@@ -11,6 +11,8 @@ func TestChatDeepseekHandler_Unmarshal(t *testing.T) {
 		`{"p":"response/fragments/-1/content","o":"APPEND","v":"收到"}`,
 		`{"v": "用户"}`,
 		`{"v":"。"}`,
+		`{"p":"response/fragments","o":"APPEND","v":[{"id":3,"type":"SEARCH","content":"","results":[]}]}`,
+		`{"p":"response/fragments/-1/results","v":[{"url":"https://example.com/a","title":"A","snippet":"a"},{"url":"https://example.com/b","title":"B","snippet":"b"}]}`,
 		`{"p":"response/fragments/-1/elapsed_secs","o":"SET","v":1.38384612}`,
 		`{"p":"response/fragments","o":"APPEND","v":[{"id":3,"type":"RESPONSE","content":"你好","references":[],"stage_id":1}]}`,
 		`{"p":"response/fragments/-1/content","v":"！"}`,
@@ -1,6 +1,7 @@
 package browser
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/playwright-community/playwright-go"
@@ -10,7 +11,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatDoubaoHandler{})
+	registerChatHandler(func() chatHandler { return &chatDoubaoHandler{} })
 }
 
 type chatDoubaoHandler struct {
@@ -18,8 +19,7 @@ type chatDoubaoHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
-
-	locChat playwright.Locator
+	spec *HandlerSpec
 }
 
 func (h *chatDoubaoHandler) Name() string {
@@ -33,48 +33,41 @@ func (h *chatDoubaoHandler) URL() string {
 func (h *chatDoubaoHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatDoubaoHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for chat main")
-	h.locChat = h.page.GetByTestId("chat_input")
-	if err = h.locChat.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
+func (h *chatDoubaoHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("wait for chat textarea")
-	locText := h.locChat.Locator("textarea")
-	if err = locText.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat textarea error")
-		return err
-	}
+func (h *chatDoubaoHandler) QRCode() (playwright.Locator, error) {
+	return h.spec.qrCode(h.log, h.page)
+}
 
-	h.log.Debug().Msg("fill prompt to chat textarea")
-	if err = locText.Fill(prompt); err != nil {
-		h.log.Error().Err(err).Msg("fill prompt to chat textarea error")
-		return err
+func (h *chatDoubaoHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatDoubaoHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "deep think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
 }
 
-func (h *chatDoubaoHandler) Send() (err error) {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.locChat.GetByTestId("chat_input_send_button")
-	if err = locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
+func (h *chatDoubaoHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	h.log.Debug().Msg("click chat send button")
-	if err = locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
+func (h *chatDoubaoHandler) Attach(files []string) error {
+	return setInputFiles(h.log, h.spec.locator(h.page, "file"), h.spec.locator(h.page, "send"), files)
+}
 
-	return nil
+func (h *chatDoubaoHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type doubaoEvent struct {
@@ -85,6 +78,14 @@ type doubaoEvent struct {
 
 type doubaoEventData struct {
 	Blocks []doubaoBlock `json:"blocks"`
+	// set in the end event when the answer was withdrawn by the moderation
+	HitSensitive bool `json:"hit_sensitive"`
+}
+
+// doubaoError is the data of the error event
+type doubaoError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type doubaoBlock struct {
@@ -109,7 +110,15 @@ func (h *chatDoubaoHandler) Unmarshal(s string) *ChatMessage {
 		h.log.Error().Err(err).Msg("unmarshal doubao event error")
 		return nil
 	}
-	if event.EventType != 2022 {
+	if event.EventType == 2005 {
+		v, e := json.UnmarshalTo[*doubaoError](event.EventData)
+		if e != nil {
+			h.log.Error().Err(e).Msg("unmarshal doubao error event error")
+			return nil
+		}
+		return upstreamError(h.Name(), strconv.Itoa(v.Code), v.Message)
+	}
+	if event.EventType != 2022 && event.EventType != 2003 {
 		return nil
 	}
 	data, err := json.UnmarshalTo[*doubaoEventData](event.EventData)
@@ -117,6 +126,12 @@ func (h *chatDoubaoHandler) Unmarshal(s string) *ChatMessage {
 		h.log.Error().Err(err).Msg("unmarshal doubao event data error")
 		return nil
 	}
+	if event.EventType == 2003 {
+		if data.HitSensitive {
+			return &ChatMessage{FinishReason: FinishContentFilter}
+		}
+		return nil
+	}
 	if len(data.Blocks) == 0 {
 		return nil
 	}
@@ -8,7 +8,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatGoogleHandler{})
+	registerChatHandler(func() chatHandler { return &chatGoogleHandler{} })
 }
 
 type chatGoogleHandler struct {
@@ -16,8 +16,7 @@ type chatGoogleHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
-
-	locChat playwright.Locator
+	spec *HandlerSpec
 }
 
 func (h *chatGoogleHandler) Name() string {
@@ -28,63 +27,46 @@ func (h *chatGoogleHandler) URL() string {
 	return "https://aistudio.google.com/prompts/new_chat"
 }
 
+// googleVariants maps the variant ids to the names in the model picker
+var googleVariants = map[string]string{
+	"gemini-2.5-pro":        "Gemini 2.5 Pro",
+	"gemini-2.5-flash":      "Gemini 2.5 Flash",
+	"gemini-2.5-flash-lite": "Gemini 2.5 Flash-Lite",
+}
+
+func (h *chatGoogleHandler) Variants() []string {
+	return variantIds(googleVariants)
+}
+
+func (h *chatGoogleHandler) DefaultVariant() string {
+	return "gemini-2.5-pro"
+}
+
 func (h *chatGoogleHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatGoogleHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for new chat link")
-	locNew := h.page.GetByRole("link", playwright.PageGetByRoleOptions{Name: "Playground"})
-	if err = locNew.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for new chat link error")
-		return err
-	}
-	h.log.Debug().Msg("click new chat link")
-	if err = locNew.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click new chat link error")
-		return err
-	}
-
-	h.log.Debug().Msg("wait for chat main")
-	h.locChat = h.page.Locator("ms-chunk-editor")
-	if err = h.locChat.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
+func (h *chatGoogleHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("wait for chat textarea")
-	locText := h.locChat.Locator("textarea")
-	if err = locText.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat textarea error")
-		return err
+func (h *chatGoogleHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
-
-	h.log.Debug().Msg("fill prompt to chat textarea")
-	if err = locText.Fill(prompt); err != nil {
-		h.log.Error().Err(err).Msg("fill prompt to chat textarea error")
+	if err := h.spec.selectVariant(h.log, h.page, googleVariants[h.options.Variant]); err != nil {
 		return err
 	}
-
-	return nil
+	return h.spec.run(h.log, h.page, "input", prompt)
 }
 
 func (h *chatGoogleHandler) Send() error {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.locChat.Locator("ms-run-button")
-	if err := locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
-
-	h.log.Debug().Msg("click chat send button")
-	if err := locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
-
-	return nil
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 func (h *chatGoogleHandler) Unmarshal(s string) *ChatMessage {
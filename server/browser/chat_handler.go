@@ -2,15 +2,21 @@ package browser
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"slices"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/playwright-community/playwright-go"
 
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
 	"github.com/starudream/aichat-proxy/server/logger"
 )
 
@@ -23,22 +29,75 @@ type chatHandler interface {
 	Unmarshal(s string) *ChatMessage
 }
 
-var chatHandlers = map[string]chatHandler{}
+// chatHandlers holds the constructors, every request gets its own handler instance
+var chatHandlers = map[string]func() chatHandler{}
 
-func registerChatHandler(h chatHandler) {
+// chatThinker is implemented by handlers whose page has a thinking switch, it is called after Input
+type chatThinker interface {
+	Thinking(enabled bool) error
+}
+
+// chatSearcher is implemented by handlers whose page has a web search switch, it is called after Thinking
+type chatSearcher interface {
+	WebSearch(enabled bool) error
+}
+
+// chatVariantsHandler is implemented by handlers whose page offers several models, the variant is requested as name/variant
+// and the handler selects it in the model picker during Input, DefaultVariant is selected for the bare name
+type chatVariantsHandler interface {
+	Variants() []string
+	DefaultVariant() string
+}
+
+// chatAttacher is implemented by handlers that can upload files into the page, it is called between Input and Send
+type chatAttacher interface {
+	Attach(files []string) error
+}
+
+func registerChatHandler(fn func() chatHandler) {
+	h := fn()
 	if _, ok := chatHandlers[h.Name()]; ok {
 		logger.Fatal().Msgf("chat handler %s already exists", h.Name())
 	}
 	logger.Info().Msgf("register chat handler %s", h.Name())
-	chatHandlers[h.Name()] = h
+	chatHandlers[h.Name()] = fn
+}
+
+// splitModel splits a model id into the handler name and the variant, the variant is empty for the handler default
+func splitModel(model string) (name, variant string) {
+	name, variant, _ = strings.Cut(model, "/")
+	return
 }
 
 func ExistModel(model string) bool {
-	_, ok := chatHandlers[model]
-	return ok
+	name, variant := splitModel(model)
+	newCh, ok := chatHandlers[name]
+	if !ok {
+		return false
+	}
+	if variant == "" {
+		return true
+	}
+	vh, ok := newCh().(chatVariantsHandler)
+	return ok && slices.Contains(vh.Variants(), variant)
 }
 
+// Models returns every handler name along with its variants as name/variant
 func Models() (ss []string) {
+	for k, newCh := range chatHandlers {
+		ss = append(ss, k)
+		if vh, ok := newCh().(chatVariantsHandler); ok {
+			for _, v := range vh.Variants() {
+				ss = append(ss, k+"/"+v)
+			}
+		}
+	}
+	slices.Sort(ss)
+	return
+}
+
+// handlerNames returns the handler names without variants, one page pool is kept per name
+func handlerNames() (ss []string) {
 	for k := range chatHandlers {
 		ss = append(ss, k)
 	}
@@ -49,10 +108,58 @@ func Models() (ss []string) {
 type ChatHandler struct {
 	Id string
 	Ch chan *ChatMessage
+	// Model is the model id that handles the chat, including the variant
+	Model string
+
+	// Account and URL are available once Ch is closed
+	Account string
+	URL     string
 }
 
-func (h *ChatHandler) WaitFinish(ctx context.Context) (string, string) {
+// WaitAnswer blocks until the first content or reasoning arrives, and fails when the chat ends without any,
+// the messages read so far are put back in front of Ch, it is called by the reader of Ch before it reads anything else
+func (h *ChatHandler) WaitAnswer(ctx context.Context) error {
+	var head []*ChatMessage
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-h.Ch:
+			if ok && msg.Error != nil {
+				return msg.Error
+			}
+			if !ok || msg.FinishReason != "" {
+				return errors.New("chat finished without answer")
+			}
+			head = append(head, msg)
+			if msg.Content == "" && msg.ReasoningContent == "" {
+				continue
+			}
+		}
+		break
+	}
+	src, dst := h.Ch, make(chan *ChatMessage, cap(h.Ch))
+	h.Ch = dst
+	go func() {
+		defer close(dst)
+		for _, msg := range head {
+			dst <- msg
+		}
+		for msg := range src {
+			select {
+			case dst <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// WaitFinish collects the whole answer, the FinishReason is the one of the last message and Error is set when the chat failed
+func (h *ChatHandler) WaitFinish(ctx context.Context) *ChatMessage {
 	content, reason := &bytes.Buffer{}, &bytes.Buffer{}
+	out := &ChatMessage{}
 	for {
 		next := false
 		select {
@@ -62,106 +169,224 @@ func (h *ChatHandler) WaitFinish(ctx context.Context) (string, string) {
 				break
 			}
 			next = true
+			out.Citations = MergeCitations(out.Citations, msg.Citations...)
 			if msg.Content != "" {
 				content.WriteString(msg.Content)
 			} else if msg.ReasoningContent != "" {
 				reason.WriteString(msg.ReasoningContent)
 			}
+			if msg.FinishReason != "" {
+				out.FinishReason = msg.FinishReason
+			}
+			if msg.Error != nil {
+				out.Error = msg.Error
+			}
 		}
 		if !next {
 			break
 		}
 	}
-	return content.String(), reason.String()
+	out.Content, out.ReasoningContent = content.String(), reason.String()
+	return out
 }
 
+// finish reasons of the last message, the same as the openai ones
+const (
+	FinishStop          = "stop"
+	FinishLength        = "length"
+	FinishContentFilter = "content_filter"
+)
+
 type ChatMessage struct {
-	Index            string `json:"index,omitempty"`
-	Content          string `json:"content,omitempty"`
-	ReasoningContent string `json:"reasoning_content,omitempty"`
-	FinishReason     string `json:"finish_reason,omitempty"`
+	Index            string          `json:"index,omitempty"`
+	Content          string          `json:"content,omitempty"`
+	ReasoningContent string          `json:"reasoning_content,omitempty"`
+	Citations        []*ChatCitation `json:"citations,omitempty"`
+	FinishReason     string          `json:"finish_reason,omitempty"`
+	// Error ends the chat instead of a FinishReason, such as a stream that stops answering
+	Error error `json:"-"`
+}
+
+// ChatCitation is a web page referenced by the answer, usually found by the web search of the provider
+type ChatCitation struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+}
+
+// MergeCitations appends the citations of src whose url is not in dst yet
+func MergeCitations(dst []*ChatCitation, src ...*ChatCitation) []*ChatCitation {
+	for _, v := range src {
+		if v == nil || v.URL == "" || slices.ContainsFunc(dst, func(c *ChatCitation) bool { return c.URL == v.URL }) {
+			continue
+		}
+		dst = append(dst, v)
+	}
+	return dst
 }
 
 type HandleChatOptions struct {
 	log  logger.ZLogger
 	page playwright.Page
 
+	Account string
+	// Conversation is the url of an existing conversation to continue, instead of starting a new one
+	Conversation string
+	// Files are local paths to upload along with the prompt
+	Files []string
+	// Variant is the model to select in the page, set by HandleChat to the handler default when the model has none
+	Variant string
+
+	// Thinking and WebSearch are one of auto, enabled, disabled, the toggle in the page is left as is on auto,
+	// an empty Thinking is auto and an empty WebSearch is config.G().BrowserSearch
 	Thinking  string
 	WebSearch string
+
+	// Priority orders the requests waiting for a page, see PriorityHigh
+	Priority int
+	// OnQueue is called with the position when the request has to wait for a page, and again at the keepalive interval
+	OnQueue func(position int)
 }
 
 func (s *Browser) HandleChat(ctx context.Context, model, prompt string, options HandleChatOptions) (hdr *ChatHandler, err error) {
-	ch, ok := chatHandlers[model]
-	if !ok {
+	if !ExistModel(model) {
 		return hdr, fmt.Errorf("model not found: %s", model)
 	}
-
-	defer func() {
-		if err != nil {
-			s.resetPages(ch.URL())
+	fullModel := model
+	model, options.Variant = splitModel(model)
+	newCh := chatHandlers[model]
+	if vh, ok := newCh().(chatVariantsHandler); ok && options.Variant == "" {
+		// the picker keeps the variant of the previous chat in the page, so the default one is always selected
+		options.Variant = vh.DefaultVariant()
+	}
+	switch options.Thinking {
+	case "", "auto":
+	case "enabled", "disabled":
+		if _, ok := newCh().(chatThinker); !ok {
+			return hdr, errx.BadRequest().WithMsgf("model %s does not support switching thinking", model)
 		}
-	}()
+	default:
+		return hdr, errx.BadRequest().WithMsgf("invalid thinking type: %s", options.Thinking)
+	}
+	if _, ok := newCh().(chatSearcher); ok && options.WebSearch == "" {
+		// the switch keeps the state of the previous chat in the page, so it is always set unless asked otherwise
+		options.WebSearch = config.G().BrowserSearch
+	}
+	switch options.WebSearch {
+	case "", "auto":
+	case "enabled", "disabled":
+		if _, ok := newCh().(chatSearcher); !ok {
+			return hdr, errx.BadRequest().WithMsgf("model %s does not support switching web search", model)
+		}
+	default:
+		return hdr, errx.BadRequest().WithMsgf("invalid web search type: %s", options.WebSearch)
+	}
+	if _, ok := newCh().(chatAttacher); !ok && len(options.Files) > 0 {
+		return hdr, errx.BadRequest().WithMsgf("model %s does not support attachments", model)
+	}
 
-	page, err := s.openPage(ch.URL())
+	acc, err := s.pickAccount(model, options.Account)
 	if err != nil {
 		return hdr, err
 	}
-
-	page.SetDefaultTimeout(5 * 1000)
+	ch, pool := newCh(), acc.pools[model]
+	if pool.status.blocked() {
+		return hdr, captchaError(model, acc.name)
+	}
 
 	hdr = &ChatHandler{
-		Id: uuid.Must(uuid.NewV7()).String(),
-		Ch: make(chan *ChatMessage, 1024),
+		Id:      uuid.Must(uuid.NewV7()).String(),
+		Ch:      make(chan *ChatMessage, 1024),
+		Model:   fullModel,
+		Account: acc.name,
 	}
 
-	log := logger.With().Str("model", model).Str("handlerId", hdr.Id).Logger()
+	log := logger.With().Str("model", model).Str("variant", options.Variant).Str("account", acc.name).Str("handlerId", hdr.Id).Logger()
 
-	done := atomic.Bool{}
+	log.Debug().Msg("acquire page")
+	page, err := pool.acquire(ctx, options.Conversation, options.Priority, options.OnQueue)
+	if err != nil {
+		return hdr, err
+	}
+	log.Debug().Msg("page acquired")
+
+	page.SetDefaultTimeout(5 * 1000)
+
+	trace := acc.startTrace(log)
+
+	pch := listenProxy(hdr.Id)
+	quit := make(chan struct{})
+
+	done, idle := atomic.Bool{}, atomic.Bool{}
 	finish := func() {
 		if done.CompareAndSwap(false, true) {
 			log.Debug().Msg("handle finish")
-			time.Sleep(200 * time.Millisecond)
-			close(hdr.Ch)
-			s.mu.Unlock()
-			log.Debug().Msg("release lock")
-			_, _ = page.Evaluate(`window.__aichat_proxy_active_time=Date.now();window.__aichat_proxy_idle_timer=setInterval(()=>{const t=window.__aichat_proxy_active_time;if(t&&Date.now()-t>3e4){window.location.href="about:blank"}},5e3);`)
+			close(quit)
 		}
 	}
 
-	_, _ = page.Evaluate(`if(window.__aichat_proxy_idle_timer){clearInterval(window.__aichat_proxy_idle_timer)}`)
+	// the producer keeps its own reference, WaitAnswer puts a relay channel in front of hdr.Ch
+	out := hdr.Ch
 
-	go func() {
-		<-ctx.Done()
-		finish()
-	}()
+	route := streamRoute(model)
+	routeHandler := func(r playwright.Route) {
+		headers := r.Request().Headers()
+		headers[proxyHandlerHeader] = hdr.Id
+		_ = r.Continue(playwright.RouteContinueOptions{Headers: headers})
+	}
 
-	log.Debug().Msg("acquire lock")
-	s.mu.Lock()
-	defer func() {
-		if err != nil {
-			finish()
+	send := func(msg *ChatMessage) {
+		select {
+		case out <- msg:
+		case <-quit:
 		}
-	}()
-
-	options.log = log
-	options.page = page
-	ch.Setup(options)
-
-	if err = ch.Input(prompt); err != nil {
-		return hdr, err
 	}
 
 	unix := atomic.Int64{}
 	unix.Store(time.Now().Unix())
 
+	// setupDone is closed once HandleChat returns, the page is still driven by it until then whatever ctx says,
+	// so the producer holds the page back and the error path resets it before another request gets it
+	setupDone, released := make(chan struct{}), atomic.Bool{}
+	defer close(setupDone)
+
+	// only this goroutine writes to out, so it is the one to close it and give the page back
 	go func() {
-		flag := false
+		defer func() {
+			<-setupDone
+			_ = page.Unroute(route, routeHandler)
+			unlistenProxy(hdr.Id)
+			trace.stop(log, "")
+			hdr.URL = page.URL()
+			close(out)
+			_, _ = page.Evaluate(`window.__aichat_proxy_active_time=Date.now();window.__aichat_proxy_idle_timer=setInterval(()=>{const t=window.__aichat_proxy_active_time;if(t&&Date.now()-t>3e4){window.location.href="about:blank"}},5e3);`)
+			released.Store(true)
+			pool.release(page)
+			log.Debug().Msg("release page")
+		}()
+		flag, answered := false, false
+		// reason is the end state told by the provider, it is sent once the stream closes
+		reason := ""
 		for {
-			time.Sleep(10 * time.Millisecond)
-			if done.Load() {
+			var v any
+			select {
+			case <-quit:
+				if idle.Load() {
+					// a provider that already told its end state only missed the close
+					msg := &ChatMessage{FinishReason: reason}
+					if reason == "" {
+						msg = &ChatMessage{Error: idleTimeoutError(fullModel)}
+					}
+					select {
+					case out <- msg:
+					case <-ctx.Done():
+					}
+				}
 				return
+			case <-ctx.Done():
+				finish()
+				return
+			case v = <-pch:
 			}
-			v := <-proxyChs[ch.Name()]
 			unix.Store(time.Now().Unix())
 			switch x := v.(type) {
 			case bool:
@@ -169,25 +394,107 @@ func (s *Browser) HandleChat(ctx context.Context, model, prompt string, options
 					log.Debug().Msg("listen sse start")
 					flag = true
 				} else if flag {
-					hdr.Ch <- &ChatMessage{FinishReason: "stop"}
+					send(&ChatMessage{FinishReason: cmp.Or(reason, FinishStop)})
 					log.Debug().Msg("listen sse finish")
 					finish()
+					return
 				}
 			case string:
 				if flag {
 					msg := ch.Unmarshal(x)
+					if msg != nil && msg.Error != nil {
+						log.Warn().Err(msg.Error).Msg("upstream error")
+						var ee *errx.Error
+						if errors.As(msg.Error, &ee) {
+							ee.AppendMetadata(map[string]any{"account": acc.name})
+							if ee.Code == errx.CodeLoginExpired {
+								pool.status.set(StateLoggedOut, ee)
+							}
+						}
+						send(msg)
+						finish()
+						return
+					}
+					if msg != nil && msg.FinishReason != "" {
+						log.Debug().Msgf("finish reason %s", msg.FinishReason)
+						reason, msg.FinishReason = msg.FinishReason, ""
+						if msg.Content == "" && msg.ReasoningContent == "" && len(msg.Citations) == 0 {
+							msg = nil
+						}
+					}
 					if msg != nil {
-						hdr.Ch <- msg
+						if !answered {
+							answered = true
+							pool.status.succeed()
+						}
+						send(msg)
 					}
 				}
 			}
 		}
 	}()
 
+	defer func() {
+		if err != nil {
+			if ctx.Err() == nil {
+				captureDebug(log, hdr, page, trace, err)
+			}
+			// tell a login wall or captcha from other errors before the page is reset
+			if checker, ok := newCh().(chatChecker); ok && ctx.Err() == nil {
+				if pool.checkPage(log, checker, page) == StateCaptcha {
+					err = captchaError(model, acc.name)
+				}
+			} else if ctx.Err() == nil {
+				pool.status.set(StateError, err)
+			}
+			if !released.Load() {
+				pool.reset(page)
+			}
+			finish()
+		}
+	}()
+
+	_, _ = page.Evaluate(`if(window.__aichat_proxy_idle_timer){clearInterval(window.__aichat_proxy_idle_timer)}`)
+
+	// the correlation header only goes to the stream requests, other hosts never see it
+	err = page.Route(route, routeHandler)
+	if err != nil {
+		log.Error().Err(err).Msg("route stream requests error")
+		return hdr, err
+	}
+
+	options.log = log
+	options.page = page
+	ch.Setup(options)
+
+	if err = ch.Input(prompt); err != nil {
+		return hdr, err
+	}
+
+	if options.Thinking == "enabled" || options.Thinking == "disabled" {
+		if err = ch.(chatThinker).Thinking(options.Thinking == "enabled"); err != nil {
+			return hdr, err
+		}
+	}
+
+	if options.WebSearch == "enabled" || options.WebSearch == "disabled" {
+		if err = ch.(chatSearcher).WebSearch(options.WebSearch == "enabled"); err != nil {
+			return hdr, err
+		}
+	}
+
+	if len(options.Files) > 0 {
+		if err = ch.(chatAttacher).Attach(options.Files); err != nil {
+			return hdr, err
+		}
+	}
+
 	if err = ch.Send(); err != nil {
 		return hdr, err
 	}
 
+	unix.Store(time.Now().Unix())
+
 	go func() {
 		for {
 			time.Sleep(time.Second)
@@ -195,6 +502,9 @@ func (s *Browser) HandleChat(ctx context.Context, model, prompt string, options
 				return
 			}
 			if t := unix.Load(); time.Now().Unix()-t >= 30 {
+				log.Warn().Msg("stream idle timeout")
+				captureDebug(log, hdr, page, trace, errors.New("stream idle for 30s"))
+				idle.Store(true)
 				finish()
 				return
 			}
@@ -203,3 +513,157 @@ func (s *Browser) HandleChat(ctx context.Context, model, prompt string, options
 
 	return hdr, nil
 }
+
+func idleTimeoutError(model string) error {
+	return errx.GatewayTimeout().WithMsgf("model %s stopped answering for 30s", model)
+}
+
+var (
+	upstreamRateLimitWords = []string{"rate_limit", "rate limit", "ratelimit", "too many", "resource_exhausted", "频繁", "上限", "限流"}
+	upstreamLoginWords     = []string{"login", "unauth", "expired", "登录", "过期"}
+)
+
+// upstreamError is an error the provider tells in its stream, it is told apart by the code and the message of the provider,
+// anything neither rate limited nor logged out is taken as the provider being busy
+func upstreamError(model, code, msg string) *ChatMessage {
+	text := strings.ToLower(code + " " + msg)
+	has := func(words []string) bool {
+		return slices.ContainsFunc(words, func(w string) bool { return strings.Contains(text, w) })
+	}
+	var err *errx.Error
+	switch {
+	case has(upstreamRateLimitWords):
+		err = errx.TooManyRequests().WithCode(errx.CodeRateLimit).WithMsgf("model %s is rate limited: %s", model, msg)
+	case has(upstreamLoginWords):
+		err = errx.Unauthorized().WithCode(errx.CodeLoginExpired).WithMsgf("model %s login expired: %s", model, msg)
+	default:
+		err = errx.ServiceUnavailable().WithCode(errx.CodeServerBusy).WithMsgf("model %s is busy: %s", model, msg)
+	}
+	return &ChatMessage{Error: err.WithMetadata(map[string]any{"model": model})}
+}
+
+// setInputFiles uploads files through the file input, and waits until the send button is usable again
+func setInputFiles(log logger.ZLogger, input, send playwright.Locator, files []string) error {
+	log.Debug().Msgf("set %d input files", len(files))
+	if err := input.SetInputFiles(files); err != nil {
+		log.Error().Err(err).Msg("set input files error")
+		return err
+	}
+
+	log.Debug().Msg("wait for upload finish")
+	for range 60 {
+		time.Sleep(500 * time.Millisecond)
+		enabled, err := send.IsEnabled()
+		if err != nil || !enabled {
+			continue
+		}
+		class, _ := send.GetAttribute("class")
+		if !strings.Contains(class, "disabled") {
+			return nil
+		}
+	}
+	log.Error().Msg("wait for upload finish timeout")
+	return errors.New("wait for upload finish timeout")
+}
+
+// variantIds returns the sorted variant ids of a variant id to picker label map
+func variantIds(labels map[string]string) []string {
+	return slices.Sorted(maps.Keys(labels))
+}
+
+// selectVariant opens the model picker and clicks the option of the variant
+func selectVariant(log logger.ZLogger, picker, option playwright.Locator) error {
+	log.Debug().Msg("wait for model picker")
+	if err := picker.WaitFor(); err != nil {
+		log.Error().Err(err).Msg("wait for model picker error")
+		return err
+	}
+	log.Debug().Msg("click model picker")
+	if err := picker.Click(); err != nil {
+		log.Error().Err(err).Msg("click model picker error")
+		return err
+	}
+	log.Debug().Msg("wait for model option")
+	if err := option.WaitFor(); err != nil {
+		log.Error().Err(err).Msg("wait for model option error")
+		return err
+	}
+	log.Debug().Msg("click model option")
+	if err := option.Click(); err != nil {
+		log.Error().Err(err).Msg("click model option error")
+		return err
+	}
+	return nil
+}
+
+// switchToggle clicks the toggle button when its current state differs from enabled,
+// on is the locator of the button in its on state, it is used when the button has no aria state
+func switchToggle(log logger.ZLogger, name string, loc, on playwright.Locator, enabled bool) error {
+	log.Debug().Msgf("wait for %s button", name)
+	if err := loc.WaitFor(); err != nil {
+		log.Error().Err(err).Msgf("wait for %s button error", name)
+		return err
+	}
+	cur, known := isToggleOn(loc, on)
+	if !known {
+		log.Error().Msgf("state of %s button unknown", name)
+		return fmt.Errorf("state of %s button unknown, set its on selector", name)
+	}
+	if cur == enabled {
+		log.Debug().Msgf("%s already %s", name, toggleState(enabled))
+		return nil
+	}
+	log.Debug().Msgf("click %s button", name)
+	if err := loc.Click(); err != nil {
+		log.Error().Err(err).Msgf("click %s button error", name)
+		return err
+	}
+	time.Sleep(200 * time.Millisecond)
+	if cur, _ = isToggleOn(loc, on); cur != enabled {
+		log.Error().Msgf("switch %s to %s failed", name, toggleState(enabled))
+		return fmt.Errorf("switch %s to %s failed", name, toggleState(enabled))
+	}
+	return nil
+}
+
+// isToggleOn reads the aria state from loc, or its parents when loc is only the label of the toggle,
+// then falls back to whether the on locator matches
+func isToggleOn(loc, on playwright.Locator) (bool, bool) {
+	for range 3 {
+		if v, known := toggleAttrState(loc); known {
+			return v, true
+		}
+		loc = loc.Locator("xpath=..")
+	}
+	if on == nil {
+		return false, false
+	}
+	n, err := on.Count()
+	if err != nil {
+		return false, false
+	}
+	return n > 0, true
+}
+
+func toggleAttrState(loc playwright.Locator) (on, known bool) {
+	for _, attr := range []string{"aria-pressed", "aria-checked", "aria-selected", "data-checked", "data-state"} {
+		v, err := loc.GetAttribute(attr)
+		if err != nil || v == "" {
+			continue
+		}
+		switch strings.ToLower(v) {
+		case "true", "checked", "on", "active":
+			return true, true
+		case "false", "unchecked", "off", "inactive":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func toggleState(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
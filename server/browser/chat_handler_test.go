@@ -0,0 +1,75 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestModels(t *testing.T) {
+	models := Models()
+	for _, m := range []string{"qwen", "qwen/qwen3-max", "google/gemini-2.5-flash", "zhipu/glm-4.5-air"} {
+		if !slices.Contains(models, m) {
+			t.Errorf("model %s not listed", m)
+		}
+		if !ExistModel(m) {
+			t.Errorf("model %s not exist", m)
+		}
+	}
+	for _, m := range []string{"qwen/unknown", "deepseek/deepseek-v3", "unknown"} {
+		if ExistModel(m) {
+			t.Errorf("model %s should not exist", m)
+		}
+	}
+	for _, name := range handlerNames() {
+		if vh, ok := chatHandlers[name]().(chatVariantsHandler); ok && !slices.Contains(vh.Variants(), vh.DefaultVariant()) {
+			t.Errorf("default variant %s of %s not listed", vh.DefaultVariant(), name)
+		}
+	}
+}
+
+func TestWaitFinish(t *testing.T) {
+	h := &ChatHandler{Ch: make(chan *ChatMessage, 4)}
+	h.Ch <- &ChatMessage{ReasoningContent: "hmm"}
+	h.Ch <- &ChatMessage{Content: "hi"}
+	h.Ch <- &ChatMessage{FinishReason: FinishContentFilter}
+	close(h.Ch)
+	r := h.WaitFinish(context.Background())
+	if r.Content != "hi" || r.ReasoningContent != "hmm" || r.FinishReason != FinishContentFilter || r.Error != nil {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	timeout := idleTimeoutError("qwen")
+	h = &ChatHandler{Ch: make(chan *ChatMessage, 4)}
+	h.Ch <- &ChatMessage{Error: timeout}
+	close(h.Ch)
+	if err := h.WaitAnswer(context.Background()); !errors.Is(err, timeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitAnswerRelay(t *testing.T) {
+	src := make(chan *ChatMessage, 1)
+	h := &ChatHandler{Ch: src}
+	go func() {
+		// the producer only knows its own channel, like HandleChat
+		src <- &ChatMessage{Citations: []*ChatCitation{{URL: "https://example.com"}}}
+		src <- &ChatMessage{ReasoningContent: "hmm"}
+		for _, v := range []string{"a", "b", "c"} {
+			src <- &ChatMessage{Content: v}
+		}
+		src <- &ChatMessage{FinishReason: FinishStop}
+		close(src)
+	}()
+	if err := h.WaitAnswer(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r := h.WaitFinish(context.Background())
+	if r.Content != "abc" || r.ReasoningContent != "hmm" || len(r.Citations) != 1 || r.FinishReason != FinishStop {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if _, ok := <-h.Ch; ok {
+		t.Error("channel should be closed")
+	}
+}
@@ -1,6 +1,8 @@
 package browser
 
 import (
+	"strings"
+
 	"github.com/playwright-community/playwright-go"
 
 	"github.com/starudream/aichat-proxy/server/internal/json"
@@ -8,7 +10,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatKimiHandler{})
+	registerChatHandler(func() chatHandler { return &chatKimiHandler{} })
 }
 
 type chatKimiHandler struct {
@@ -16,8 +18,7 @@ type chatKimiHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
-
-	locChat playwright.Locator
+	spec *HandlerSpec
 }
 
 func (h *chatKimiHandler) Name() string {
@@ -31,48 +32,37 @@ func (h *chatKimiHandler) URL() string {
 func (h *chatKimiHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatKimiHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for chat main")
-	h.locChat = h.page.Locator("div.chat-editor")
-	if err = h.locChat.WaitFor(); err != nil {
-		logger.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
-
-	h.log.Debug().Msg("wait for chat editor")
-	locText := h.locChat.GetByRole("textbox")
-	if err = locText.WaitFor(); err != nil {
-		logger.Error().Err(err).Msg("wait for chat editor error")
-		return err
-	}
+func (h *chatKimiHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("fill prompt to chat editor")
-	if err = locText.Fill(prompt); err != nil {
-		logger.Error().Err(err).Msg("fill prompt to chat editor error")
-		return err
+func (h *chatKimiHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatKimiHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "long think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
 }
 
-func (h *chatKimiHandler) Send() error {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.locChat.Locator("div.send-button")
-	if err := locSend.WaitFor(); err != nil {
-		logger.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
+func (h *chatKimiHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	h.log.Debug().Msg("click chat send button")
-	if err := locSend.Click(); err != nil {
-		logger.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
+func (h *chatKimiHandler) Attach(files []string) error {
+	return setInputFiles(h.log, h.spec.locator(h.page, "file"), h.spec.locator(h.page, "send"), files)
+}
 
-	return nil
+func (h *chatKimiHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type kimiEvent struct {
@@ -88,7 +78,25 @@ type kimiEvent struct {
 		Text struct {
 			Content string `json:"content"`
 		} `json:"text,omitempty"`
+		Search struct {
+			Results []*kimiSearchResult `json:"results,omitempty"`
+		} `json:"search,omitempty"`
 	} `json:"block"`
+	Message struct {
+		// MESSAGE_STATUS_COMPLETED, MESSAGE_STATUS_BLOCKED or MESSAGE_STATUS_TRUNCATED
+		Status string `json:"status"`
+	} `json:"message"`
+	// the connect error of the end of stream message
+	Error *struct {
+		// resource_exhausted, unauthenticated, unavailable, ...
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type kimiSearchResult struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
 func (h *chatKimiHandler) Unmarshal(s string) *ChatMessage {
@@ -99,11 +107,29 @@ func (h *chatKimiHandler) Unmarshal(s string) *ChatMessage {
 	if err != nil {
 		return nil
 	}
+	if event.Error != nil {
+		return upstreamError(h.Name(), event.Error.Code, event.Error.Message)
+	}
 	switch event.Mask {
 	case "block.think.content":
 		return &ChatMessage{ReasoningContent: event.Block.Think.Content}
 	case "block.text.content":
 		return &ChatMessage{Content: event.Block.Text.Content}
+	case "message.status":
+		switch {
+		case strings.HasSuffix(event.Message.Status, "BLOCKED"):
+			return &ChatMessage{FinishReason: FinishContentFilter}
+		case strings.HasSuffix(event.Message.Status, "TRUNCATED"):
+			return &ChatMessage{FinishReason: FinishLength}
+		}
+		return nil
+	}
+	if strings.HasPrefix(event.Mask, "block.search") && len(event.Block.Search.Results) > 0 {
+		msg := &ChatMessage{}
+		for _, v := range event.Block.Search.Results {
+			msg.Citations = MergeCitations(msg.Citations, &ChatCitation{Title: v.Title, URL: v.URL})
+		}
+		return msg
 	}
 	return nil
 }
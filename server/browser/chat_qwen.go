@@ -10,7 +10,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatQwenHandler{})
+	registerChatHandler(func() chatHandler { return &chatQwenHandler{} })
 }
 
 type chatQwenHandler struct {
@@ -18,8 +18,7 @@ type chatQwenHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
-
-	locChat playwright.Locator
+	spec *HandlerSpec
 }
 
 func (h *chatQwenHandler) Name() string {
@@ -30,81 +29,68 @@ func (h *chatQwenHandler) URL() string {
 	return "https://chat.qwen.ai"
 }
 
+// qwenVariants maps the variant ids to the names in the model picker
+var qwenVariants = map[string]string{
+	"qwen3-max":            "Qwen3-Max",
+	"qwen3-235b-a22b-2507": "Qwen3-235B-A22B-2507",
+	"qwen3-coder":          "Qwen3-Coder",
+	"qwen-max":             "Qwen2.5-Max",
+}
+
+func (h *chatQwenHandler) Variants() []string {
+	return variantIds(qwenVariants)
+}
+
+func (h *chatQwenHandler) DefaultVariant() string {
+	return "qwen3-max"
+}
+
 func (h *chatQwenHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatQwenHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for chat main")
-	h.locChat = h.page.Locator("div#chat-message-input")
-	if err = h.locChat.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
-
-	if h.options.Thinking != "disabled" {
-		h.log.Debug().Msg("wait for deep think button")
-		locThink := h.locChat.Locator("button.common-btn-padding")
-		if err = locThink.WaitFor(); err != nil {
-			h.log.Error().Err(err).Msg("wait for deep think button error")
-		} else {
-			h.log.Debug().Msg("click deep think button")
-			if err = locThink.Click(); err != nil {
-				h.log.Error().Err(err).Msg("click deep think button error")
-			}
-		}
-	}
+func (h *chatQwenHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	if h.options.WebSearch != "disabled" {
-		h.log.Debug().Msg("wait for web search button")
-		locSearch := h.locChat.Locator("button.websearch_button")
-		if err = locSearch.WaitFor(); err != nil {
-			h.log.Error().Err(err).Msg("wait for web search button error")
-		} else {
-			h.log.Debug().Msg("click web search button")
-			if err = locSearch.Click(); err != nil {
-				h.log.Error().Err(err).Msg("click web search button error")
-			}
+func (h *chatQwenHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
 		}
 	}
-
-	h.log.Debug().Msg("wait for chat textarea")
-	locText := h.locChat.Locator("textarea#chat-input")
-	if err = locText.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat textarea error")
-		return err
-	}
-
-	h.log.Debug().Msg("fill prompt to chat textarea")
-	if err = locText.Fill(prompt); err != nil {
-		h.log.Error().Err(err).Msg("fill prompt to chat textarea error")
+	if err := h.spec.selectVariant(h.log, h.page, qwenVariants[h.options.Variant]); err != nil {
 		return err
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatQwenHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "deep think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
 }
 
-func (h *chatQwenHandler) Send() (err error) {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.locChat.Locator("button#send-message-button")
-	if err = locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
+func (h *chatQwenHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	h.log.Debug().Msg("click chat send button")
-	if err = locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
+func (h *chatQwenHandler) Attach(files []string) error {
+	return setInputFiles(h.log, h.spec.locator(h.page, "file"), h.spec.locator(h.page, "send"), files)
+}
 
-	return nil
+func (h *chatQwenHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type qwenEvent struct {
 	Choices []qwenEventChoice `json:"choices"`
+	Error   *struct {
+		// RateLimited, Unauthorized, ...
+		Code    string `json:"code"`
+		Details string `json:"details"`
+	} `json:"error,omitempty"`
 }
 
 type qwenEventChoice struct {
@@ -117,6 +103,8 @@ type qwenEventChoice struct {
 		// typing/finished
 		Status string `json:"status"`
 	} `json:"delta"`
+	// stop/length/content_filter, only in the last event
+	FinishReason string `json:"finish_reason"`
 }
 
 func (h *chatQwenHandler) Unmarshal(s string) *ChatMessage {
@@ -129,15 +117,27 @@ func (h *chatQwenHandler) Unmarshal(s string) *ChatMessage {
 		h.log.Error().Err(err).Msg("unmarshal qwen event error")
 		return nil
 	}
+	if event.Error != nil {
+		return upstreamError(h.Name(), event.Error.Code, event.Error.Details)
+	}
 	if len(event.Choices) == 0 {
 		return nil
 	}
+	msg := &ChatMessage{}
+	switch reason := event.Choices[0].FinishReason; reason {
+	case FinishLength, FinishContentFilter:
+		// the last event may still carry text, HandleChat sends it before the reason
+		msg.FinishReason = reason
+	}
 	delta := event.Choices[0].Delta
 	switch delta.Phase {
 	case "think":
-		return &ChatMessage{ReasoningContent: delta.Content}
+		msg.ReasoningContent = delta.Content
 	case "answer":
-		return &ChatMessage{Content: delta.Content}
+		msg.Content = delta.Content
+	}
+	if msg.FinishReason == "" && msg.Content == "" && msg.ReasoningContent == "" {
+		return nil
 	}
-	return nil
+	return msg
 }
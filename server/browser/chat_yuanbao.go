@@ -10,7 +10,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatYuanbaoHandler{})
+	registerChatHandler(func() chatHandler { return &chatYuanbaoHandler{} })
 }
 
 type chatYuanbaoHandler struct {
@@ -18,8 +18,7 @@ type chatYuanbaoHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
-
-	locChat playwright.Locator
+	spec *HandlerSpec
 }
 
 func (h *chatYuanbaoHandler) Name() string {
@@ -33,59 +32,54 @@ func (h *chatYuanbaoHandler) URL() string {
 func (h *chatYuanbaoHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatYuanbaoHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for chat main")
-	h.locChat = h.page.Locator("div.yb-input-box-textarea")
-	if err = h.locChat.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat main error")
-		return err
-	}
+func (h *chatYuanbaoHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	h.log.Debug().Msg("wait for chat editor")
-	locEditor := h.locChat.Locator("div.ql-editor")
-	if err = locEditor.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat editor error")
-		return err
-	}
+func (h *chatYuanbaoHandler) QRCode() (playwright.Locator, error) {
+	return h.spec.qrCode(h.log, h.page)
+}
 
-	h.log.Debug().Msg("fill prompt to chat editor")
-	if err = locEditor.Fill(prompt); err != nil {
-		logger.Error().Err(err).Msg("fill prompt to chat editor error")
-		return err
+func (h *chatYuanbaoHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
+		}
 	}
-
-	return nil
+	return h.spec.run(h.log, h.page, "input", prompt)
 }
 
-func (h *chatYuanbaoHandler) Send() error {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.locChat.Locator("a#yuanbao-send-btn")
-	if err := locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
-		return err
-	}
+func (h *chatYuanbaoHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "deep think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
+}
 
-	h.log.Debug().Msg("click chat send button")
-	if err := locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
-		return err
-	}
+func (h *chatYuanbaoHandler) WebSearch(enabled bool) error {
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	return nil
+func (h *chatYuanbaoHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type yuanbaoEvent struct {
-	// think/text
+	// think/text/searchGuid
 	Type    string `json:"type"`
 	Msg     string `json:"msg,omitempty"`
 	Content string `json:"content,omitempty"`
+	// searchGuid
+	Docs []struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"docs,omitempty"`
 }
 
 // {"type":"think","title":"思考中...","iconType":9,"content":"雨","status":1}
 // {"type":"text","msg":"日"}
+// {"type":"searchGuid","title":"找到 2 篇资料作为参考","docs":[{"index":1,"title":"...","url":"https://..."}]}
 
 func (h *chatYuanbaoHandler) Unmarshal(s string) *ChatMessage {
 	s = strings.TrimPrefix(s, "data:")
@@ -101,6 +95,14 @@ func (h *chatYuanbaoHandler) Unmarshal(s string) *ChatMessage {
 		return &ChatMessage{ReasoningContent: event.Content}
 	case "text":
 		return &ChatMessage{Content: event.Msg}
+	case "searchGuid":
+		msg := &ChatMessage{}
+		for _, v := range event.Docs {
+			msg.Citations = MergeCitations(msg.Citations, &ChatCitation{Title: v.Title, URL: v.URL})
+		}
+		if len(msg.Citations) > 0 {
+			return msg
+		}
 	}
 	return nil
 }
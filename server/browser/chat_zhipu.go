@@ -10,7 +10,7 @@ import (
 )
 
 func init() {
-	registerChatHandler(&chatZhiPuHandler{})
+	registerChatHandler(func() chatHandler { return &chatZhiPuHandler{} })
 }
 
 type chatZhiPuHandler struct {
@@ -18,6 +18,7 @@ type chatZhiPuHandler struct {
 
 	log  logger.ZLogger
 	page playwright.Page
+	spec *HandlerSpec
 
 	blocks []string
 }
@@ -30,86 +31,72 @@ func (h *chatZhiPuHandler) URL() string {
 	return "https://chat.z.ai"
 }
 
+// zhipuVariants maps the variant ids to the names in the model picker
+var zhipuVariants = map[string]string{
+	"glm-4.6":     "GLM-4.6",
+	"glm-4.5":     "GLM-4.5",
+	"glm-4.5-air": "GLM-4.5-Air",
+	"glm-4.5v":    "GLM-4.5V",
+}
+
+func (h *chatZhiPuHandler) Variants() []string {
+	return variantIds(zhipuVariants)
+}
+
+func (h *chatZhiPuHandler) DefaultVariant() string {
+	return "glm-4.6"
+}
+
 func (h *chatZhiPuHandler) Setup(options HandleChatOptions) {
 	h.log = options.log
 	h.page = options.page
+	h.spec = handlerSpec(h.Name())
 	h.options = options
 }
 
-func (h *chatZhiPuHandler) Input(prompt string) (err error) {
-	h.log.Debug().Msg("wait for new chat button")
-	locNew := h.page.Locator("button#new-chat-button")
-	if err = locNew.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for new chat button error")
-		return err
-	}
-	h.log.Debug().Msg("click new chat button")
-	if err = locNew.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click new chat button error")
-		return err
-	}
+func (h *chatZhiPuHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
 
-	if h.options.WebSearch != "disabled" {
-		h.log.Debug().Msg("wait for tool button")
-		locTool := h.page.Locator("button", playwright.PageLocatorOptions{HasText: "工具"}).First()
-		if err = locTool.WaitFor(); err != nil {
-			h.log.Error().Err(err).Msg("wait for tool button error")
-		} else {
-			h.log.Debug().Msg("click tool button")
-			if err = locTool.Click(); err != nil {
-				h.log.Error().Err(err).Msg("click tool button error")
-			}
-			h.log.Debug().Msgf("wait for web search button")
-			locSearch := h.page.Locator("button", playwright.PageLocatorOptions{HasText: "全网搜索"})
-			if err = locSearch.WaitFor(); err != nil {
-				h.log.Error().Err(err).Msg("wait for web search button error")
-			} else {
-				h.log.Debug().Msg("click web search button")
-				if err = locSearch.Click(); err != nil {
-					h.log.Error().Err(err).Msg("click web search button error")
-				}
-			}
-			if err = locTool.Click(); err != nil {
-				h.log.Error().Err(err).Msg("click tool button error")
-			}
+func (h *chatZhiPuHandler) Input(prompt string) error {
+	if h.options.Conversation == "" {
+		if err := h.spec.run(h.log, h.page, "newChat", ""); err != nil {
+			return err
 		}
 	}
-
-	h.log.Debug().Msg("wait for chat textarea")
-	locText := h.page.Locator("textarea#chat-input")
-	if err = locText.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat textarea error")
-		return err
-	}
-
-	h.log.Debug().Msg("fill prompt to chat textarea")
-	if err = locText.Focus(); err != nil {
-		h.log.Error().Err(err).Msg("focus chat textarea error")
-		return err
-	}
-	if err = locText.Fill(prompt); err != nil {
-		logger.Error().Err(err).Msg("fill prompt to chat textarea error")
+	if err := h.spec.selectVariant(h.log, h.page, zhipuVariants[h.options.Variant]); err != nil {
 		return err
 	}
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
 
-	return nil
+func (h *chatZhiPuHandler) Thinking(enabled bool) error {
+	return switchToggle(h.log, "deep think", h.spec.locator(h.page, "think"), h.spec.onLocator(h.page, "think"), enabled)
 }
 
-func (h *chatZhiPuHandler) Send() error {
-	h.log.Debug().Msg("wait for chat send button")
-	locSend := h.page.Locator("button#send-message-button")
-	if err := locSend.WaitFor(); err != nil {
-		h.log.Error().Err(err).Msg("wait for chat send button error")
+func (h *chatZhiPuHandler) WebSearch(enabled bool) (err error) {
+	h.log.Debug().Msg("wait for tool button")
+	locTool := h.spec.locator(h.page, "tool")
+	if err = locTool.WaitFor(); err != nil {
+		h.log.Error().Err(err).Msg("wait for tool button error")
 		return err
 	}
-
-	h.log.Debug().Msg("click chat send button")
-	if err := locSend.Click(); err != nil {
-		h.log.Error().Err(err).Msg("click chat send button error")
+	h.log.Debug().Msg("click tool button")
+	if err = locTool.Click(); err != nil {
+		h.log.Error().Err(err).Msg("click tool button error")
 		return err
 	}
+	// close the tool menu whatever happens to the search switch
+	defer func() {
+		if e := locTool.Click(); e != nil {
+			h.log.Error().Err(e).Msg("click tool button error")
+		}
+	}()
+	return switchToggle(h.log, "web search", h.spec.locator(h.page, "search"), h.spec.onLocator(h.page, "search"), enabled)
+}
 
-	return nil
+func (h *chatZhiPuHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
 }
 
 type zhipuEvent struct {
@@ -121,6 +108,14 @@ type zhipuEvent struct {
 		DeltaContent string `json:"delta_content"`
 		// EditIndex    int    `json:"edit_index"`
 		EditContent string `json:"edit_content"`
+		// web search
+		SearchResult []struct {
+			Title string `json:"title"`
+			URL   string `json:"url"`
+		} `json:"search_result,omitempty"`
+		Error *struct {
+			Detail string `json:"detail"`
+		} `json:"error,omitempty"`
 	} `json:"data,omitempty"`
 }
 
@@ -133,13 +128,25 @@ func (h *chatZhiPuHandler) Unmarshal(s string) *ChatMessage {
 	if err != nil {
 		return nil
 	}
+	if event.Data.Error != nil {
+		return upstreamError(h.Name(), "", event.Data.Error.Detail)
+	}
+	if len(event.Data.SearchResult) > 0 {
+		msg := &ChatMessage{}
+		for _, v := range event.Data.SearchResult {
+			msg.Citations = MergeCitations(msg.Citations, &ChatCitation{Title: v.Title, URL: v.URL})
+		}
+		return msg
+	}
 	content := event.Data.DeltaContent
 	if content != "" {
 		h.blocks = append(h.blocks, content)
 	} else if event.Data.EditContent != "" {
-		t := strings.Join(h.blocks[len(h.blocks)-3:], "")
-		i := strings.LastIndex(event.Data.EditContent, t)
-		if i >= 0 {
+		// the edit repeats the text so far, only what follows the last blocks is new, all of it when nothing came before
+		t := strings.Join(h.blocks[max(0, len(h.blocks)-3):], "")
+		if t == "" {
+			content = event.Data.EditContent
+		} else if i := strings.LastIndex(event.Data.EditContent, t); i >= 0 {
 			content = event.Data.EditContent[i+len(t):]
 		}
 	}
@@ -0,0 +1,187 @@
+package browser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+const (
+	debugScreenshotFile = "screenshot.png"
+	debugHTMLFile       = "page.html"
+	debugTraceFile      = "trace.zip"
+	debugErrorFile      = "error.txt"
+)
+
+// DebugCapture is the page state saved in DebugPath/<handlerId> when a handler fails
+type DebugCapture struct {
+	Id    string
+	Files []string
+	Size  int64
+	Time  time.Time
+}
+
+// debugTrace is the trace chunk of one chat, the tracing of a context is shared by all its pages,
+// so only one chat of an account is traced at a time
+type debugTrace struct {
+	acc  *account
+	once sync.Once
+}
+
+func (s *account) startTracing() {
+	if !config.G().DebugTrace {
+		return
+	}
+	err := s.bc.Tracing().Start(playwright.TracingStartOptions{Screenshots: playwright.Bool(true), Snapshots: playwright.Bool(true)})
+	if err != nil {
+		logger.Error().Err(err).Str("account", s.name).Msg("start tracing error")
+	}
+}
+
+// startTrace returns nil when tracing is disabled or another chat of the account is being traced
+func (s *account) startTrace(log logger.ZLogger) *debugTrace {
+	if !config.G().DebugTrace || !s.traceMu.TryLock() {
+		return nil
+	}
+	if err := s.bc.Tracing().StartChunk(); err != nil {
+		log.Error().Err(err).Msg("start trace chunk error")
+		s.traceMu.Unlock()
+		return nil
+	}
+	return &debugTrace{acc: s}
+}
+
+// stop saves the chunk to the path, or drops it when the path is empty, only the first call counts
+func (t *debugTrace) stop(log logger.ZLogger, path string) {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		defer t.acc.traceMu.Unlock()
+		var err error
+		if path == "" {
+			err = t.acc.bc.Tracing().StopChunk()
+		} else {
+			err = t.acc.bc.Tracing().StopChunk(path)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("stop trace chunk error")
+		}
+	})
+}
+
+// captureDebug saves a full page screenshot, the html and the trace of the failed chat, then applies the retention policy
+func captureDebug(log logger.ZLogger, hdr *ChatHandler, page playwright.Page, trace *debugTrace, reason error) {
+	if !config.G().DebugCapture {
+		trace.stop(log, "")
+		return
+	}
+	dir := filepath.Join(config.DebugPath, hdr.Id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error().Err(err).Msg("create debug dir error")
+		trace.stop(log, "")
+		return
+	}
+
+	text := fmt.Sprintf("model: %s\naccount: %s\nurl: %s\ntime: %s\nerror: %v\n", hdr.Model, hdr.Account, page.URL(), time.Now().Format(time.RFC3339), reason)
+	if err := os.WriteFile(filepath.Join(dir, debugErrorFile), []byte(text), 0644); err != nil {
+		log.Error().Err(err).Msg("write debug error file error")
+	}
+	_, err := page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(filepath.Join(dir, debugScreenshotFile)),
+		Type:     playwright.ScreenshotTypePng,
+		FullPage: playwright.Bool(true),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("debug screenshot error")
+	}
+	if html, err := page.Content(); err != nil {
+		log.Error().Err(err).Msg("debug page content error")
+	} else if err = os.WriteFile(filepath.Join(dir, debugHTMLFile), []byte(html), 0644); err != nil {
+		log.Error().Err(err).Msg("write debug html error")
+	}
+	trace.stop(log, filepath.Join(dir, debugTraceFile))
+	log.Warn().Msgf("debug capture saved to %s", dir)
+
+	pruneDebug(log)
+}
+
+// pruneDebug removes the captures older than the max age, then the oldest ones until the total size fits
+func pruneDebug(log logger.ZLogger) {
+	captures, err := DebugCaptures()
+	if err != nil {
+		log.Error().Err(err).Msg("list debug captures error")
+		return
+	}
+	maxAge, maxSize := config.G().DebugMaxAge, config.G().DebugMaxSize<<20
+	total := int64(0)
+	for _, c := range captures {
+		total += c.Size
+	}
+	// captures are sorted from the newest
+	for i := len(captures) - 1; i >= 0; i-- {
+		c := captures[i]
+		if (maxAge <= 0 || time.Since(c.Time) <= maxAge) && (maxSize <= 0 || total <= maxSize) {
+			break
+		}
+		if err = os.RemoveAll(filepath.Join(config.DebugPath, c.Id)); err != nil {
+			log.Error().Err(err).Msgf("remove debug capture %s error", c.Id)
+			continue
+		}
+		total -= c.Size
+	}
+}
+
+// DebugCaptures lists the saved captures from the newest
+func DebugCaptures() ([]*DebugCapture, error) {
+	entries, err := os.ReadDir(config.DebugPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var captures []*DebugCapture
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		c := &DebugCapture{Id: entry.Name(), Time: info.ModTime()}
+		files, _ := os.ReadDir(filepath.Join(config.DebugPath, entry.Name()))
+		for _, file := range files {
+			if fi, err := file.Info(); err == nil && !file.IsDir() {
+				c.Files = append(c.Files, file.Name())
+				c.Size += fi.Size()
+			}
+		}
+		captures = append(captures, c)
+	}
+	slices.SortFunc(captures, func(a, b *DebugCapture) int { return b.Time.Compare(a.Time) })
+	return captures, nil
+}
+
+// DebugFile returns the path of a file in a capture
+func DebugFile(id, file string) (string, error) {
+	if id != filepath.Base(id) || file != filepath.Base(file) || strings.HasPrefix(id, ".") || strings.HasPrefix(file, ".") {
+		return "", errx.BadRequest().WithMsgf("invalid debug file: %s/%s", id, file)
+	}
+	path := filepath.Join(config.DebugPath, id, file)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+		return "", errx.NotFound().WithMsgf("debug file not found: %s/%s", id, file)
+	}
+	return path, nil
+}
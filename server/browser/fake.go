@@ -0,0 +1,137 @@
+//go:build e2e
+
+package browser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/fakechat"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// the fake handler is only built with -tags e2e, it drives the site of internal/fakechat
+
+func init() {
+	registerChatHandler(func() chatHandler { return &chatFakeHandler{} })
+	mitmHosts[fakechat.Host] = &mitmModule{
+		Name:         "fake",
+		TypePrefix:   "text/event-stream",
+		PathContains: "/api/chat",
+	}
+	selectorSpec.Store(Selectors().merge(&SelectorSpec{Version: selectorSpecVersion, Handlers: map[string]*HandlerSpec{
+		"fake": {
+			Selectors: map[string]string{
+				"ready": "textarea#prompt",
+				"login": "button#login",
+				"input": "textarea#prompt",
+				"send":  "button#send",
+			},
+			Steps: map[string][]*SelectorStep{
+				"input": {{Action: "wait", Selector: "$input"}, {Action: "fill", Selector: "$input", Value: "{{prompt}}"}},
+				"send":  {{Action: "click", Selector: "$send"}},
+			},
+		},
+	}}))
+}
+
+type chatFakeHandler struct {
+	options HandleChatOptions
+
+	log  logger.ZLogger
+	page playwright.Page
+	spec *HandlerSpec
+}
+
+func (h *chatFakeHandler) Name() string {
+	return "fake"
+}
+
+func (h *chatFakeHandler) URL() string {
+	return "http://" + fakechat.Host
+}
+
+func (h *chatFakeHandler) Setup(options HandleChatOptions) {
+	h.log = options.log
+	h.page = options.page
+	h.spec = handlerSpec(h.Name())
+	h.options = options
+}
+
+func (h *chatFakeHandler) Check() (string, error) {
+	return h.spec.checkPage(h.page)
+}
+
+func (h *chatFakeHandler) Input(prompt string) error {
+	return h.spec.run(h.log, h.page, "input", prompt)
+}
+
+func (h *chatFakeHandler) Send() error {
+	return h.spec.run(h.log, h.page, "send", "")
+}
+
+func (h *chatFakeHandler) Unmarshal(s string) *ChatMessage {
+	s = strings.TrimPrefix(s, "data: ")
+	if s == "" || s == "[DONE]" {
+		return nil
+	}
+	event, err := json.UnmarshalTo[*fakechat.Event](s)
+	if err != nil {
+		return nil
+	}
+	switch event.Type {
+	case "think":
+		return &ChatMessage{ReasoningContent: event.Content}
+	case "text":
+		return &ChatMessage{Content: event.Content}
+	case "error":
+		return upstreamError(h.Name(), "", event.Content)
+	}
+	return nil
+}
+
+// StartFake starts the proxy and a headless playwright firefox with one account in dir, routed to the fake site at addr,
+// it fails when the playwright driver or firefox is not installed
+func StartFake(ctx context.Context, wg *sync.WaitGroup, addr, dir string) error {
+	pw, err := playwright.Run(&playwright.RunOptions{SkipInstallBrowsers: true})
+	if err != nil {
+		return fmt.Errorf("playwright run error: %w", err)
+	}
+	if _, err = os.Stat(pw.Firefox.ExecutablePath()); err != nil {
+		_ = pw.Stop()
+		return fmt.Errorf("firefox not installed: %w", err)
+	}
+
+	proxyDialOverrides[fakechat.Host+":80"] = addr
+	startProxy(ctx, wg)
+
+	b = &Browser{
+		pw: pw,
+		co: &CamoufoxOptions{
+			ExecutablePath: pw.Firefox.ExecutablePath(),
+			Headless:       true,
+			Proxy:          &Proxy{Server: "http://" + config.ProxyAddress},
+		},
+	}
+	acc := newAccount(b, "fake")
+	acc.path = dir
+	acc.launchBrowser()
+	b.accounts = append(b.accounts, acc)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		_ = acc.bc.Close()
+		_ = pw.Stop()
+	}()
+	return nil
+}
@@ -0,0 +1,221 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// chatQRLoginer is implemented by handlers whose site logs in by scanning a qr code,
+// it opens the login dialog when needed and returns the qr code element
+type chatQRLoginer interface {
+	QRCode() (playwright.Locator, error)
+}
+
+// loginTTL is how long a login tab is kept open
+const loginTTL = 10 * time.Minute
+
+// LoginSession is a dedicated tab to log into a provider by hand through the admin api
+type LoginSession struct {
+	Id      string
+	Model   string
+	Account string
+
+	acc  *account
+	ch   chatHandler
+	page playwright.Page
+	log  logger.ZLogger
+
+	mu    sync.Mutex
+	timer *time.Timer
+	// expires is when the timer closes the tab, the session is gone from then on even if closing takes a while
+	expires time.Time
+}
+
+type LoginAction struct {
+	// Type is one of fill, click, press, phone, code
+	Type string
+	// Selector is a playwright selector, Text of click is matched exactly when Selector is empty
+	Selector string
+	Text     string
+	// X and Y are the page coordinates to click when both Selector and Text are empty
+	X, Y float64
+}
+
+const (
+	loginPhoneSelector = `input[type="tel"], input[placeholder*="手机号"], input[placeholder*="phone" i]`
+	loginCodeSelector  = `input[placeholder*="验证码"], input[placeholder*="code" i], input[autocomplete="one-time-code"]`
+)
+
+var (
+	loginSessions   = map[string]*LoginSession{}
+	loginSessionsMu sync.Mutex
+)
+
+// StartLogin opens the provider page in a new tab of the account, the first account is used when it is empty
+func (s *Browser) StartLogin(model, account string) (*LoginSession, error) {
+	if s == nil {
+		return nil, errx.ServiceUnavailable().WithMsgf("browser not ready")
+	}
+	name, _ := splitModel(model)
+	newCh, ok := chatHandlers[name]
+	if !ok {
+		return nil, errx.NotFound().WithMsgf("model not found: %s", model)
+	}
+	acc, err := s.getAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	page, err := acc.openPage()
+	if err != nil {
+		return nil, err
+	}
+
+	ls := &LoginSession{
+		Id:      uuid.Must(uuid.NewV7()).String(),
+		Model:   name,
+		Account: acc.name,
+		acc:     acc,
+		ch:      newCh(),
+		page:    page,
+	}
+	ls.log = logger.With().Str("model", name).Str("account", acc.name).Str("loginId", ls.Id).Logger()
+	ls.ch.Setup(HandleChatOptions{log: ls.log, page: page})
+
+	if _, err = page.Goto(ls.ch.URL(), playwright.PageGotoOptions{Timeout: playwright.Float(30 * 1000)}); err != nil {
+		ls.log.Error().Err(err).Msg("login page goto error")
+		_ = page.Close()
+		return nil, err
+	}
+	ls.log.Info().Msg("login page opened")
+
+	ls.expires = time.Now().Add(loginTTL)
+	ls.timer = time.AfterFunc(loginTTL, func() { ls.Close(context.Background()) })
+	loginSessionsMu.Lock()
+	loginSessions[ls.Id] = ls
+	loginSessionsMu.Unlock()
+
+	return ls, nil
+}
+
+func GetLogin(id string) (*LoginSession, error) {
+	loginSessionsMu.Lock()
+	defer loginSessionsMu.Unlock()
+	ls, ok := loginSessions[id]
+	if !ok || !time.Now().Before(ls.expires) {
+		return nil, errx.NotFound().WithMsgf("login session not found: %s", id)
+	}
+	return ls, nil
+}
+
+func (ls *LoginSession) URL() string {
+	return ls.page.URL()
+}
+
+// Screenshot returns a jpeg of the visible part of the page
+func (ls *LoginSession) Screenshot() ([]byte, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.page.Screenshot(playwright.PageScreenshotOptions{
+		Type:    playwright.ScreenshotTypeJpeg,
+		Quality: playwright.Int(70),
+	})
+}
+
+// QRCode returns a png of the qr code element
+func (ls *LoginSession) QRCode() ([]byte, error) {
+	qr, ok := ls.ch.(chatQRLoginer)
+	if !ok {
+		return nil, errx.BadRequest().WithMsgf("model %s does not support qr code login", ls.Model)
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	loc, err := qr.QRCode()
+	if err != nil {
+		return nil, err
+	}
+	return loc.Screenshot(playwright.LocatorScreenshotOptions{Type: playwright.ScreenshotTypePng})
+}
+
+// validate checks the action before it touches the page
+func (a *LoginAction) validate() error {
+	switch a.Type {
+	case "fill":
+		if a.Selector == "" {
+			return errx.BadRequest().WithMsgf("selector is required")
+		}
+		fallthrough
+	case "phone", "code", "press":
+		if a.Text == "" {
+			return errx.BadRequest().WithMsgf("text is required")
+		}
+	case "click":
+	default:
+		return errx.BadRequest().WithMsgf("invalid login action type: %s", a.Type)
+	}
+	return nil
+}
+
+// Do runs one action in the page
+func (ls *LoginSession) Do(action *LoginAction) (err error) {
+	if err = action.validate(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.log.Debug().Msgf("login action %s", action.Type)
+	switch action.Type {
+	case "fill", "phone", "code":
+		selector := action.Selector
+		if selector == "" && action.Type == "phone" {
+			selector = loginPhoneSelector
+		} else if selector == "" && action.Type == "code" {
+			selector = loginCodeSelector
+		}
+		err = ls.page.Locator(selector).First().Fill(action.Text)
+	case "click":
+		switch {
+		case action.Selector != "":
+			err = ls.page.Locator(action.Selector).First().Click()
+		case action.Text != "":
+			err = ls.page.GetByText(action.Text, playwright.PageGetByTextOptions{Exact: playwright.Bool(true)}).First().Click()
+		default:
+			err = ls.page.Mouse().Click(action.X, action.Y)
+		}
+	case "press":
+		err = ls.page.Keyboard().Press(action.Text)
+	}
+	if err != nil {
+		ls.log.Error().Err(err).Msgf("login action %s error", action.Type)
+		return fmt.Errorf("login action %s error: %w", action.Type, err)
+	}
+	return nil
+}
+
+// Close closes the tab and checks the provider again, so the status reflects the login right away
+func (ls *LoginSession) Close(ctx context.Context) {
+	loginSessionsMu.Lock()
+	_, ok := loginSessions[ls.Id]
+	delete(loginSessions, ls.Id)
+	loginSessionsMu.Unlock()
+	if !ok {
+		return
+	}
+	ls.timer.Stop()
+
+	ls.mu.Lock()
+	_ = ls.page.Close()
+	ls.mu.Unlock()
+	ls.log.Info().Msg("login page closed")
+
+	ls.acc.pools[ls.Model].check(ctx)
+}
@@ -0,0 +1,64 @@
+package browser
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+)
+
+func TestGetLogin(t *testing.T) {
+	loginSessionsMu.Lock()
+	loginSessions["live"] = &LoginSession{Id: "live", expires: time.Now().Add(time.Minute)}
+	loginSessions["expired"] = &LoginSession{Id: "expired", expires: time.Now().Add(-time.Second)}
+	loginSessionsMu.Unlock()
+	defer func() {
+		loginSessionsMu.Lock()
+		delete(loginSessions, "live")
+		delete(loginSessions, "expired")
+		loginSessionsMu.Unlock()
+	}()
+
+	if ls, err := GetLogin("live"); err != nil || ls.Id != "live" {
+		t.Fatalf("expect the live session, got %v %v", ls, err)
+	}
+	for _, id := range []string{"expired", "unknown"} {
+		var ee *errx.Error
+		if _, err := GetLogin(id); !errors.As(err, &ee) || ee.Status != http.StatusNotFound {
+			t.Errorf("expect not found for %s, got %v", id, err)
+		}
+	}
+}
+
+func TestLoginActionValidate(t *testing.T) {
+	for _, tc := range []struct {
+		action *LoginAction
+		ok     bool
+	}{
+		{&LoginAction{Type: "fill", Selector: "input", Text: "x"}, true},
+		{&LoginAction{Type: "fill", Text: "x"}, false},
+		{&LoginAction{Type: "fill", Selector: "input"}, false},
+		{&LoginAction{Type: "phone", Text: "13800000000"}, true},
+		{&LoginAction{Type: "phone"}, false},
+		{&LoginAction{Type: "code", Text: "123456"}, true},
+		{&LoginAction{Type: "code"}, false},
+		{&LoginAction{Type: "press", Text: "Enter"}, true},
+		{&LoginAction{Type: "press"}, false},
+		{&LoginAction{Type: "click", X: 10, Y: 20}, true},
+		{&LoginAction{Type: "click", Text: "登录"}, true},
+		{&LoginAction{Type: "hover", Selector: "input"}, false},
+		{&LoginAction{}, false},
+	} {
+		err := tc.action.validate()
+		if (err == nil) != tc.ok {
+			t.Errorf("%+v: unexpected result %v", tc.action, err)
+			continue
+		}
+		var ee *errx.Error
+		if err != nil && (!errors.As(err, &ee) || ee.Status != http.StatusBadRequest) {
+			t.Errorf("%+v: expect bad request, got %v", tc.action, err)
+		}
+	}
+}
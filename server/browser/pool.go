@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"context"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// pagePool holds the tabs of one chat handler, at most size of them are in use at the same time,
+// the other requests wait in the queue by priority
+type pagePool struct {
+	acc *account
+
+	name string
+	url  string
+	size int
+
+	mu        sync.Mutex
+	inUse     int
+	waiters   []*pageWaiter
+	seq       uint64
+	queueSize int
+
+	idle chan playwright.Page
+
+	status poolStatus
+}
+
+func newPagePool(acc *account, name, url string) *pagePool {
+	size := config.G().BrowserPoolSize
+	if v, ok := config.G().BrowserPoolModels[name]; ok {
+		size = v
+	}
+	if size <= 0 {
+		size = 1
+	}
+	queueSize := config.G().BrowserQueueSize
+	if v, ok := config.G().BrowserQueueModels[name]; ok {
+		queueSize = v
+	}
+	logger.Info().Str("account", acc.name).Msgf("page pool %s size %d queue %d", name, size, queueSize)
+	return &pagePool{
+		acc:       acc,
+		name:      name,
+		url:       url,
+		size:      size,
+		queueSize: queueSize,
+		idle:      make(chan playwright.Page, size),
+	}
+}
+
+// acquire waits for a slot, then takes an idle page and navigates it to url, the handler url is used when url is empty
+func (p *pagePool) acquire(ctx context.Context, url string, priority int, notify func(position int)) (page playwright.Page, err error) {
+	if url == "" {
+		url = p.url
+	}
+
+	if err = p.wait(ctx, priority, notify); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			p.release(page)
+		}
+	}()
+
+	for page == nil {
+		select {
+		case page = <-p.idle:
+			if page.IsClosed() {
+				page = nil
+			}
+		default:
+			page, err = p.acc.claimPage(p.url)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if page.URL() == url {
+		return page, nil
+	}
+
+	_, err = page.Goto(url, playwright.PageGotoOptions{
+		Timeout:   playwright.Float(30 * 1000),
+		WaitUntil: playwright.WaitUntilStateLoad,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("page goto error")
+		return page, err
+	}
+
+	logger.Info().Msgf("page goto %q ready", url)
+
+	return page, nil
+}
+
+func (p *pagePool) release(page playwright.Page) {
+	if page != nil && !page.IsClosed() {
+		p.idle <- page
+	}
+	p.done()
+}
+
+func (p *pagePool) reset(page playwright.Page) {
+	if page != nil && !page.IsClosed() {
+		_, _ = page.Goto("about:blank")
+	}
+}
@@ -2,14 +2,18 @@ package browser
 
 import (
 	"bufio"
-	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/binary"
 	stdjson "encoding/json"
 	"errors"
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -30,7 +34,9 @@ func startProxy(ctx context.Context, wg *sync.WaitGroup) {
 	proxy.Logger = writer.NewPrefixWriter("proxy")
 	proxy.KeepDestinationHeaders = true
 	proxy.KeepHeader = true
+	proxy.Tr.DialContext = dialProxy
 	proxy.OnRequest(goproxy.ReqConditionFunc(onRequest)).HandleConnectFunc(handleConnect)
+	proxy.OnRequest(goproxy.ReqConditionFunc(onRequest)).DoFunc(doRequest)
 	proxy.OnResponse().DoFunc(doResponse)
 
 	srv := &http.Server{Addr: config.ProxyAddress, Handler: proxy}
@@ -47,11 +53,6 @@ func startProxy(ctx context.Context, wg *sync.WaitGroup) {
 		}
 	}()
 
-	proxyChs = map[string]chan any{}
-	for _, m := range Models() {
-		proxyChs[m] = make(chan any, 4096)
-	}
-
 	wg.Add(1)
 
 	go func() {
@@ -65,6 +66,19 @@ func startProxy(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
+// proxyDialOverrides maps the host:port of an upstream to another address,
+// the end to end tests serve a local site under a provider like name this way
+var proxyDialOverrides = map[string]string{}
+
+var proxyDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+func dialProxy(ctx context.Context, network, addr string) (net.Conn, error) {
+	if v, ok := proxyDialOverrides[addr]; ok {
+		addr = v
+	}
+	return proxyDialer.DialContext(ctx, network, addr)
+}
+
 type mitmModule struct {
 	Name         string
 	TypePrefix   string
@@ -126,7 +140,62 @@ func handleConnect(host string, _ *goproxy.ProxyCtx) (*goproxy.ConnectAction, st
 	return &goproxy.ConnectAction{Action: goproxy.ConnectMitm, TLSConfig: newTLSConfig}, host
 }
 
-var proxyChs map[string]chan any
+// proxyHandlerHeader is added to the stream requests by HandleChat, so the intercepted response can be routed back to the handler
+const proxyHandlerHeader = "X-Aichat-Proxy-Handler"
+
+// streamRoute matches the urls of the stream requests of the handler, the only ones to carry proxyHandlerHeader
+func streamRoute(name string) *regexp.Regexp {
+	var ss []string
+	for host, module := range mitmHosts {
+		if module.Name != name {
+			continue
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		ss = append(ss, `^https?://`+regexp.QuoteMeta(host)+`(:\d+)?/[^?#]*`+regexp.QuoteMeta(module.PathContains))
+	}
+	if len(ss) == 0 {
+		// a handler without module has nothing to intercept
+		return regexp.MustCompile(`^$`)
+	}
+	slices.Sort(ss)
+	return regexp.MustCompile(strings.Join(ss, "|"))
+}
+
+var (
+	proxyChs   = map[string]chan any{}
+	proxyChsMu sync.RWMutex
+)
+
+func listenProxy(id string) chan any {
+	ch := make(chan any, 4096)
+	proxyChsMu.Lock()
+	proxyChs[id] = ch
+	proxyChsMu.Unlock()
+	return ch
+}
+
+func unlistenProxy(id string) {
+	proxyChsMu.Lock()
+	delete(proxyChs, id)
+	proxyChsMu.Unlock()
+}
+
+func getProxyCh(id string) (chan any, bool) {
+	proxyChsMu.RLock()
+	defer proxyChsMu.RUnlock()
+	ch, ok := proxyChs[id]
+	return ch, ok
+}
+
+func doRequest(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+	if id := req.Header.Get(proxyHandlerHeader); id != "" {
+		req.Header.Del(proxyHandlerHeader)
+		ctx.UserData = id
+	}
+	return req, nil
+}
 
 func doResponse(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
 	if resp == nil {
@@ -139,12 +208,19 @@ func doResponse(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
 	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
 	contentEncoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
 	if strings.HasPrefix(contentType, module.TypePrefix) && strings.Contains(ctx.Req.URL.Path, module.PathContains) {
-		logger.Debug().Str("host", ctx.Req.URL.Host).Str("path", ctx.Req.URL.Path).Msg("proxy response detected")
+		id, _ := ctx.UserData.(string)
+		log := logger.With().Str("host", ctx.Req.URL.Host).Str("path", ctx.Req.URL.Path).Str("handlerId", id).Logger()
+		ch, ok := getProxyCh(id)
+		if !ok {
+			log.Debug().Msg("proxy response without listening handler, skip")
+			return resp
+		}
+		log.Debug().Msg("proxy response detected")
 		pr, pw := io.Pipe()
 		resp.Body = newTeeReader(resp.Body, pw)
 		go func() {
 			defer func() { _ = pr.Close() }()
-			proxyChs[module.Name] <- true
+			ch <- true
 			logger.Debug().Msg("proxy handle stream start")
 			var rr io.Reader = pr
 			switch contentEncoding {
@@ -153,22 +229,51 @@ func doResponse(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
 			case "br":
 				rr = brotli.NewReader(pr)
 			}
-			switch module.Name {
-			case "google":
-				handleStreamGoogle(module, rr)
-			case "kimi":
-				handleStreamKimi(module, rr)
-			default:
-				handleStreamLine(module, rr)
+			if f := recordStream(log, module.Name, id); f != nil {
+				defer func() { _ = f.Close() }()
+				rr = io.TeeReader(rr, f)
 			}
+			handleStream(module.Name, ch, rr)
 			logger.Debug().Msg("proxy handle stream finish")
-			proxyChs[module.Name] <- false
+			ch <- false
 		}()
 	}
 	return resp
 }
 
-func handleStreamGoogle(module *mitmModule, rr io.Reader) {
+// handleStream splits the decoded body of the module into the raw events passed to the handler
+func handleStream(name string, ch chan any, rr io.Reader) {
+	switch name {
+	case "google":
+		handleStreamGoogle(ch, rr)
+	case "kimi":
+		handleStreamKimi(ch, rr)
+	default:
+		handleStreamLine(ch, rr)
+	}
+}
+
+// recordStream creates the file to save the decoded body to when recording is enabled,
+// the files can be copied to testdata/replay as new fixtures
+func recordStream(log logger.ZLogger, name, id string) *os.File {
+	if !config.G().DebugRecord {
+		return nil
+	}
+	dir := filepath.Join(config.RecordPath, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error().Err(err).Msg("create record dir error")
+		return nil
+	}
+	f, err := os.Create(filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+id+".raw"))
+	if err != nil {
+		log.Error().Err(err).Msg("create record file error")
+		return nil
+	}
+	log.Debug().Str("path", f.Name()).Msg("proxy record stream")
+	return f
+}
+
+func handleStreamGoogle(ch chan any, rr io.Reader) {
 	dec := stdjson.NewDecoder(rr)
 	for i := 1; i <= 2; i++ {
 		delim, err := dec.Token()
@@ -192,7 +297,7 @@ func handleStreamGoogle(module *mitmModule, rr io.Reader) {
 		}
 		text := json.MustMarshalToString(v)
 		logger.Debug().Msgf("proxy stream raw: %s", text)
-		pushStreamEvent(module, text)
+		pushStreamEvent(ch, text)
 	}
 	suffix, err := io.ReadAll(dec.Buffered())
 	if err != nil {
@@ -205,36 +310,37 @@ func handleStreamGoogle(module *mitmModule, rr io.Reader) {
 	}
 }
 
-func handleStreamKimi(module *mitmModule, rr io.Reader) {
-	for sc := newDelimScanner(rr, []byte{0, 0, 0, 0}); sc.Scan(); {
-		data := sc.Bytes()
-		if len(data) <= 1 {
-			continue
-		}
-		text := conv.BytesToString(data[1:])
-		logger.Debug().Msgf("proxy stream raw: %s", text)
-		pushStreamEvent(module, text)
-	}
-}
-
-func newDelimScanner(rr io.Reader, delim []byte) *bufio.Scanner {
-	sc := bufio.NewScanner(rr)
-	sc.Split(func(data []byte, eof bool) (int, []byte, error) {
-		if eof && len(data) == 0 {
-			return 0, nil, nil
+// handleStreamKimi reads the connect envelopes, a flag byte and a big endian length before every json message
+func handleStreamKimi(ch chan any, rr io.Reader) {
+	br := bufio.NewReader(rr)
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Error().Err(err).Msg("proxy read envelope header error")
+			}
+			return
 		}
-		if i := bytes.Index(data, delim); i >= 0 {
-			return i + len(delim), data[:i], nil
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(br, data); err != nil {
+			logger.Error().Err(err).Msg("proxy read envelope data error")
+			return
 		}
-		if eof {
-			return len(data), data, nil
+		text := conv.BytesToString(data)
+		// the end of stream message carries the trailers or the error, only the error is passed on
+		if header[0]&0x02 != 0 {
+			logger.Debug().Msgf("proxy stream end: %s", text)
+			if strings.Contains(text, `"error"`) {
+				pushStreamEvent(ch, text)
+			}
+			return
 		}
-		return 0, nil, nil
-	})
-	return sc
+		logger.Debug().Msgf("proxy stream raw: %s", text)
+		pushStreamEvent(ch, text)
+	}
 }
 
-func handleStreamLine(module *mitmModule, rr io.Reader) {
+func handleStreamLine(ch chan any, rr io.Reader) {
 	for rd := bufio.NewReader(rr); ; {
 		text, err := rd.ReadString('\n')
 		if err != nil {
@@ -248,13 +354,13 @@ func handleStreamLine(module *mitmModule, rr io.Reader) {
 			continue
 		}
 		logger.Debug().Msgf("proxy stream raw: %s", text)
-		pushStreamEvent(module, text)
+		pushStreamEvent(ch, text)
 	}
 }
 
-func pushStreamEvent(module *mitmModule, text string) {
+func pushStreamEvent(ch chan any, text string) {
 	select {
-	case proxyChs[module.Name] <- text:
+	case ch <- text:
 		// normal
 	default:
 		logger.Warn().Msg("proxy stream channel full, drop all messages")
@@ -262,7 +368,7 @@ func pushStreamEvent(module *mitmModule, text string) {
 		for {
 			out := false
 			select {
-			case <-proxyChs[module.Name]:
+			case <-ch:
 				count++
 			default:
 				out = true
@@ -0,0 +1,23 @@
+package browser
+
+import (
+	"testing"
+)
+
+func TestStreamRoute(t *testing.T) {
+	route := streamRoute("deepseek")
+	for url, want := range map[string]bool{
+		"https://chat.deepseek.com/api/v0/chat/completion":         true,
+		"https://chat.deepseek.com/api/v0/chat/completion?x=1":     true,
+		"https://chat.deepseek.com/api/v0/users/current":           false,
+		"https://cdn.deepseek.com/api/v0/chat/completion":          false,
+		"https://example.com/?u=chat.deepseek.com/chat/completion": false,
+	} {
+		if route.MatchString(url) != want {
+			t.Errorf("unexpected match of %s, want %t", url, want)
+		}
+	}
+	if streamRoute("unknown").MatchString("https://chat.deepseek.com/api/v0/chat/completion") {
+		t.Error("unknown handler should match nothing")
+	}
+}
@@ -0,0 +1,173 @@
+package browser
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// priority classes of the requests waiting for a page, a higher class is served first and the same class in arrival order
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// Priority returns the priority of a class, normal for an unknown one
+func Priority(class string) int {
+	switch class {
+	case "high":
+		return PriorityHigh
+	case "low":
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// pageWaiter is a request queued for a slot of the pool, ready is closed once the slot is handed over
+type pageWaiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// wait takes a slot of the pool, the request is queued behind the running chats when all slots are taken,
+// notify is called with the position once queued and then at the keepalive interval
+func (p *pagePool) wait(ctx context.Context, priority int, notify func(position int)) error {
+	p.mu.Lock()
+	if p.inUse < p.size && len(p.waiters) == 0 {
+		p.inUse++
+		p.mu.Unlock()
+		return nil
+	}
+	if p.queueSize > 0 && len(p.waiters) >= p.queueSize {
+		p.mu.Unlock()
+		return errx.TooManyRequests().WithCode(errx.CodeQueueFull).WithMsgf("model %s has %d requests waiting", p.name, p.queueSize)
+	}
+	p.seq++
+	w := &pageWaiter{priority: priority, seq: p.seq, ready: make(chan struct{})}
+	i := slices.IndexFunc(p.waiters, func(v *pageWaiter) bool { return v.priority < priority })
+	if i < 0 {
+		i = len(p.waiters)
+	}
+	p.waiters = slices.Insert(p.waiters, i, w)
+	p.mu.Unlock()
+
+	logger.Debug().Str("model", p.name).Str("account", p.acc.name).Msgf("queued at position %d", i+1)
+
+	var timeout, tick <-chan time.Time
+	d := config.G().BrowserQueueTimeout
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	if notify != nil {
+		notify(i + 1)
+		if v := config.G().BrowserQueueKeepalive; v > 0 {
+			t := time.NewTicker(v)
+			defer t.Stop()
+			tick = t.C
+		}
+	}
+
+	for {
+		select {
+		case <-w.ready:
+			return nil
+		case <-tick:
+			if pos := p.position(w); pos > 0 {
+				notify(pos)
+			}
+		case <-ctx.Done():
+			p.leave(w)
+			return ctx.Err()
+		case <-timeout:
+			p.leave(w)
+			return errx.TooManyRequests().WithCode(errx.CodeQueueTimeout).WithMsgf("model %s waited for a page over %s", p.name, d)
+		}
+	}
+}
+
+// position returns the 1-based position of the waiter, 0 once it got the slot
+func (p *pagePool) position(w *pageWaiter) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Index(p.waiters, w) + 1
+}
+
+// leave removes a waiter that gives up, the slot handed to it meanwhile is passed on
+func (p *pagePool) leave(w *pageWaiter) {
+	p.mu.Lock()
+	if i := slices.Index(p.waiters, w); i >= 0 {
+		p.waiters = slices.Delete(p.waiters, i, i+1)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.done()
+}
+
+// done hands the slot over to the first waiter, or frees it
+func (p *pagePool) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiters) > 0 {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		close(w.ready)
+		return
+	}
+	p.inUse--
+}
+
+func (p *pagePool) busy() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse
+}
+
+// load is the chats running and waiting
+func (p *pagePool) load() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse + len(p.waiters)
+}
+
+type QueueStatus struct {
+	Name    string
+	Account string
+	// Size is the number of pages, InUse of them are chatting
+	Size  int
+	InUse int
+	// Queued requests wait for a page, at most Limit of them when it is not 0
+	Queued int
+	Limit  int
+}
+
+// Queues returns the depth of the queue of every handler in every account
+func (s *Browser) Queues() (qs []*QueueStatus) {
+	if s == nil {
+		return nil
+	}
+	for _, name := range handlerNames() {
+		for _, acc := range s.accounts {
+			pool := acc.pools[name]
+			pool.mu.Lock()
+			qs = append(qs, &QueueStatus{
+				Name:    name,
+				Account: acc.name,
+				Size:    pool.size,
+				InUse:   pool.inUse,
+				Queued:  len(pool.waiters),
+				Limit:   pool.queueSize,
+			})
+			pool.mu.Unlock()
+		}
+	}
+	return qs
+}
@@ -0,0 +1,67 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+)
+
+func TestPagePoolQueue(t *testing.T) {
+	p := &pagePool{acc: &account{name: "test"}, name: "test", size: 1, queueSize: 2}
+	ctx := context.Background()
+
+	if err := p.wait(ctx, PriorityNormal, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 2)
+	queue := func(name string, priority int) {
+		n := p.load()
+		go func() {
+			if err := p.wait(ctx, priority, nil); err != nil {
+				order <- err.Error()
+				return
+			}
+			order <- name
+		}()
+		for p.load() == n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	queue("low", PriorityLow)
+	queue("high", PriorityHigh)
+
+	var ee *errx.Error
+	if err := p.wait(ctx, PriorityHigh, nil); !errors.As(err, &ee) || ee.Code != errx.CodeQueueFull {
+		t.Fatalf("expect queue full, got %v", err)
+	}
+
+	p.done()
+	if v := <-order; v != "high" {
+		t.Fatalf("expect high first, got %s", v)
+	}
+	p.done()
+	if v := <-order; v != "low" {
+		t.Fatalf("expect low second, got %s", v)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	positions := make(chan int, 1)
+	go func() {
+		_ = p.wait(ctx, PriorityNormal, func(position int) { positions <- position })
+	}()
+	if v := <-positions; v != 1 {
+		t.Fatalf("expect position 1, got %d", v)
+	}
+	cancel()
+	for p.load() > 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.done()
+	if p.busy() != 0 {
+		t.Fatalf("expect no page in use, got %d", p.busy())
+	}
+}
@@ -0,0 +1,77 @@
+package browser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the replay tests")
+
+// TestReplay feeds every testdata/replay/<handler>/<name>.raw through the stream splitter and the Unmarshal of the handler,
+// and compares the messages with <name>.golden.jsonl, record new raw files with DEBUG_RECORD=true and run with -update
+func TestReplay(t *testing.T) {
+	files, err := filepath.Glob("testdata/replay/*/*.raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(filepath.Dir(file))
+		t.Run(name+"/"+strings.TrimSuffix(filepath.Base(file), ".raw"), func(t *testing.T) {
+			got := replayStream(t, name, file)
+			golden := strings.TrimSuffix(file, ".raw") + ".golden.jsonl"
+			if *update {
+				if err = os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("messages mismatch\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// replayStream returns the messages of the raw stream as json lines
+func replayStream(t *testing.T, name, file string) string {
+	newCh, ok := chatHandlers[name]
+	if !ok {
+		t.Fatalf("handler %s not found", name)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	ch := make(chan any, 4096)
+	handleStream(name, ch, f)
+	close(ch)
+
+	h := newCh()
+	h.Setup(HandleChatOptions{})
+	sb := &strings.Builder{}
+	for v := range ch {
+		msg := h.Unmarshal(v.(string))
+		if msg == nil {
+			continue
+		}
+		if msg.Error != nil {
+			// the error is not part of the json of a message
+			sb.WriteString(json.MustMarshalToString(map[string]any{"error": msg.Error}))
+		} else {
+			sb.WriteString(json.MustMarshalToString(msg))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
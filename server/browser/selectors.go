@@ -0,0 +1,267 @@
+package browser
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// selectorSpecVersion is bumped when selector or step names change, an override of another version is ignored
+const selectorSpecVersion = 1
+
+//go:embed selectors.json
+var defaultSelectors []byte
+
+// SelectorSpec holds the selectors and the step sequences of every handler, so a broken selector can be fixed without a release
+type SelectorSpec struct {
+	Version  int                     `json:"version"`
+	Handlers map[string]*HandlerSpec `json:"handlers"`
+}
+
+type HandlerSpec struct {
+	// AuthURLs are parts of the urls the site redirects to when logged out
+	AuthURLs []string `json:"authURLs,omitempty"`
+	// Selectors are named playwright selectors, such as ready, login, think, search and send,
+	// thinkOn and searchOn match the toggles only in their on state, for the sites without aria state
+	Selectors map[string]string `json:"selectors,omitempty"`
+	// Steps are the named step sequences, newChat runs for a new conversation, then input and send
+	Steps map[string][]*SelectorStep `json:"steps,omitempty"`
+}
+
+type SelectorStep struct {
+	// Action is one of wait, click, focus, fill and press
+	Action string `json:"action"`
+	// Selector is a playwright selector, or the name of one in the selectors prefixed by $
+	Selector string `json:"selector"`
+	// Value is the text to fill or the key to press, {{prompt}} is replaced by the prompt
+	Value string `json:"value,omitempty"`
+}
+
+// selectorSpec is set up before any init, so init functions may merge more handlers into it
+var selectorSpec = func() *atomic.Pointer[SelectorSpec] {
+	spec, err := parseSelectorSpec(defaultSelectors)
+	if err == nil {
+		err = spec.validate()
+	}
+	if err != nil {
+		panic(fmt.Errorf("default selector spec: %w", err))
+	}
+	p := &atomic.Pointer[SelectorSpec]{}
+	p.Store(spec)
+	return p
+}()
+
+// Selectors returns the spec in use, the defaults merged with the override
+func Selectors() *SelectorSpec {
+	return selectorSpec.Load()
+}
+
+func parseSelectorSpec(bs []byte) (*SelectorSpec, error) {
+	spec, err := json.UnmarshalTo[*SelectorSpec](bs)
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("empty spec")
+	}
+	if spec.Version != selectorSpecVersion {
+		return nil, fmt.Errorf("version %d is not supported, expect %d", spec.Version, selectorSpecVersion)
+	}
+	return spec, nil
+}
+
+// merge returns a copy of the spec overridden by another one, selectors are replaced one by one and steps by sequence
+func (s *SelectorSpec) merge(o *SelectorSpec) *SelectorSpec {
+	out := &SelectorSpec{Version: s.Version, Handlers: map[string]*HandlerSpec{}}
+	for name, hs := range s.Handlers {
+		out.Handlers[name] = &HandlerSpec{AuthURLs: hs.AuthURLs, Selectors: maps.Clone(hs.Selectors), Steps: maps.Clone(hs.Steps)}
+	}
+	for name, hs := range o.Handlers {
+		cur, ok := out.Handlers[name]
+		if !ok {
+			cur = &HandlerSpec{Selectors: map[string]string{}, Steps: map[string][]*SelectorStep{}}
+			out.Handlers[name] = cur
+		}
+		if hs.AuthURLs != nil {
+			cur.AuthURLs = hs.AuthURLs
+		}
+		maps.Copy(cur.Selectors, hs.Selectors)
+		maps.Copy(cur.Steps, hs.Steps)
+	}
+	return out
+}
+
+// validate checks the actions and that every step refers to a known selector
+func (s *SelectorSpec) validate() error {
+	for name, hs := range s.Handlers {
+		for seq, steps := range hs.Steps {
+			for i, step := range steps {
+				switch step.Action {
+				case "wait", "click", "focus", "fill", "press":
+				default:
+					return fmt.Errorf("%s step %s[%d]: invalid action %q", name, seq, i, step.Action)
+				}
+				if step.Selector == "" {
+					return fmt.Errorf("%s step %s[%d]: selector is required", name, seq, i)
+				}
+				if ref, ok := strings.CutPrefix(step.Selector, "$"); ok && hs.Selectors[ref] == "" {
+					return fmt.Errorf("%s step %s[%d]: selector %s not found", name, seq, i, ref)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// loadSelectors applies the override file on top of the defaults, the current spec is kept when the file is invalid
+func loadSelectors(path string) error {
+	def, err := parseSelectorSpec(defaultSelectors)
+	if err != nil {
+		return err
+	}
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		selectorSpec.Store(def)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	override, err := parseSelectorSpec(bs)
+	if err != nil {
+		return err
+	}
+	spec := def.merge(override)
+	if err = spec.validate(); err != nil {
+		return err
+	}
+	selectorSpec.Store(spec)
+	return nil
+}
+
+// watchSelectors reloads the override file whenever it changes, so an operator can fix a selector on the fly
+func watchSelectors(ctx context.Context) {
+	path := config.G().BrowserSelectors
+	if path == "" {
+		return
+	}
+	var last time.Time
+	for {
+		var mod time.Time
+		if fi, err := os.Stat(path); err == nil {
+			mod = fi.ModTime()
+		}
+		if !mod.Equal(last) {
+			last = mod
+			if err := loadSelectors(path); err != nil {
+				logger.Error().Err(err).Str("path", path).Msg("load selectors error, keep the previous ones")
+			} else if !mod.IsZero() {
+				logger.Info().Str("path", path).Msg("selectors loaded")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// handlerSpec returns the spec of the handler, an empty one when the handler has none
+func handlerSpec(name string) *HandlerSpec {
+	if hs, ok := Selectors().Handlers[name]; ok {
+		return hs
+	}
+	return &HandlerSpec{}
+}
+
+// selector resolves a selector of the step, a name prefixed by $ is looked up in the selectors
+func (hs *HandlerSpec) selector(s string) string {
+	if ref, ok := strings.CutPrefix(s, "$"); ok {
+		return hs.Selectors[ref]
+	}
+	return s
+}
+
+// locator returns the locator of a named selector
+func (hs *HandlerSpec) locator(page playwright.Page, name string) playwright.Locator {
+	return page.Locator(hs.Selectors[name])
+}
+
+// onLocator returns the locator of the named toggle in its on state, nil when the spec has no such selector
+func (hs *HandlerSpec) onLocator(page playwright.Page, name string) playwright.Locator {
+	s := hs.Selectors[name+"On"]
+	if s == "" {
+		return nil
+	}
+	return page.Locator(s)
+}
+
+// checkPage is checkPage with the ready and login selectors and the auth urls of the spec
+func (hs *HandlerSpec) checkPage(page playwright.Page) (string, error) {
+	return checkPage(page, hs.locator(page, "ready"), hs.locator(page, "login"), hs.AuthURLs...)
+}
+
+// run runs a step sequence in the page, a sequence the spec does not have is a no-op
+func (hs *HandlerSpec) run(log logger.ZLogger, page playwright.Page, seq, prompt string) error {
+	for _, step := range hs.Steps[seq] {
+		loc := page.Locator(hs.selector(step.Selector))
+		value := strings.ReplaceAll(step.Value, "{{prompt}}", prompt)
+		log.Debug().Msgf("%s %s %s", seq, step.Action, step.Selector)
+		var err error
+		switch step.Action {
+		case "wait":
+			err = loc.WaitFor()
+		case "click":
+			err = loc.Click()
+		case "focus":
+			err = loc.Focus()
+		case "fill":
+			err = loc.Fill(value)
+		case "press":
+			err = loc.Press(value)
+		default:
+			err = fmt.Errorf("invalid action %q", step.Action)
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("%s %s %s error", seq, step.Action, step.Selector)
+			return fmt.Errorf("%s %s %s error: %w", seq, step.Action, step.Selector, err)
+		}
+	}
+	return nil
+}
+
+// selectVariant picks the option labelled exactly with the label from the variant picker
+func (hs *HandlerSpec) selectVariant(log logger.ZLogger, page playwright.Page, label string) error {
+	picker := hs.locator(page, "variantPicker")
+	option := hs.locator(page, "variantOption").GetByText(label, playwright.LocatorGetByTextOptions{Exact: playwright.Bool(true)}).First()
+	return selectVariant(log, picker, option)
+}
+
+// qrCode clicks the login button when the qr code is not shown yet, and returns the qr code element
+func (hs *HandlerSpec) qrCode(log logger.ZLogger, page playwright.Page) (playwright.Locator, error) {
+	locQR := hs.locator(page, "qrcode")
+	if v, _ := locQR.IsVisible(); !v {
+		log.Debug().Msg("click login button")
+		if err := hs.locator(page, "loginButton").Click(); err != nil {
+			log.Error().Err(err).Msg("click login button error")
+			return nil, err
+		}
+	}
+	log.Debug().Msg("wait for login qr code")
+	if err := locQR.WaitFor(); err != nil {
+		log.Error().Err(err).Msg("wait for login qr code error")
+		return nil, err
+	}
+	return locQR, nil
+}
@@ -0,0 +1,64 @@
+package browser
+
+import (
+	"testing"
+)
+
+func TestDefaultSelectors(t *testing.T) {
+	spec := Selectors()
+	for _, name := range handlerNames() {
+		hs, ok := spec.Handlers[name]
+		if !ok {
+			t.Errorf("handler %s has no spec", name)
+			continue
+		}
+		for _, key := range []string{"ready", "login"} {
+			if hs.Selectors[key] == "" {
+				t.Errorf("handler %s has no %s selector", name, key)
+			}
+		}
+		for _, key := range []string{"think", "search"} {
+			if hs.Selectors[key] != "" && hs.Selectors[key+"On"] == "" {
+				t.Errorf("handler %s has no %sOn selector", name, key)
+			}
+		}
+		for _, seq := range []string{"input", "send"} {
+			if len(hs.Steps[seq]) == 0 {
+				t.Errorf("handler %s has no %s steps", name, seq)
+			}
+		}
+	}
+}
+
+func TestSelectorSpecMerge(t *testing.T) {
+	def, err := parseSelectorSpec(defaultSelectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	override, err := parseSelectorSpec([]byte(`{"version":1,"handlers":{"deepseek":{"selectors":{"send":"button.send"},"steps":{"send":[{"action":"click","selector":"$send"},{"action":"press","selector":"$input","value":"Enter"}]}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := def.merge(override)
+	if err = spec.validate(); err != nil {
+		t.Fatal(err)
+	}
+	hs := spec.Handlers["deepseek"]
+	if hs.Selectors["send"] != "button.send" || len(hs.Steps["send"]) != 2 {
+		t.Errorf("override not applied: %v %v", hs.Selectors["send"], hs.Steps["send"])
+	}
+	if hs.Selectors["input"] == "" || len(hs.AuthURLs) == 0 {
+		t.Errorf("defaults lost: %v", hs)
+	}
+	if def.Handlers["deepseek"].Selectors["send"] == "button.send" {
+		t.Errorf("defaults modified")
+	}
+
+	bad := def.merge(&SelectorSpec{Version: 1, Handlers: map[string]*HandlerSpec{"kimi": {Steps: map[string][]*SelectorStep{"send": {{Action: "click", Selector: "$missing"}}}}}})
+	if err = bad.validate(); err == nil {
+		t.Errorf("missing selector not reported")
+	}
+	if _, err = parseSelectorSpec([]byte(`{"version":2}`)); err == nil {
+		t.Errorf("unsupported version not reported")
+	}
+}
@@ -6,6 +6,7 @@ import (
 )
 
 func Start(ctx context.Context, wg *sync.WaitGroup) {
+	go watchSelectors(ctx)
 	startProxy(ctx, wg)
 	startBrowser(ctx, wg)
 }
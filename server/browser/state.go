@@ -0,0 +1,163 @@
+package browser
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/internal/errx"
+	"github.com/starudream/aichat-proxy/server/internal/json"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+// providerDomain returns the last two labels of the handler host, e.g. qwen.ai for https://chat.qwen.ai
+func providerDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
+
+func matchDomain(host, domain string) bool {
+	host = strings.TrimPrefix(host, ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func matchOrigin(origin, domain string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && matchDomain(u.Hostname(), domain)
+}
+
+// providerAccount resolves the handler and the account of a state export or import
+func (s *Browser) providerAccount(model, account string) (*account, string, error) {
+	if s == nil {
+		return nil, "", errx.ServiceUnavailable().WithMsgf("browser not ready")
+	}
+	name, _ := splitModel(model)
+	newCh, ok := chatHandlers[name]
+	if !ok {
+		return nil, "", errx.NotFound().WithMsgf("model not found: %s", model)
+	}
+	acc, err := s.getAccount(account)
+	if err != nil {
+		return nil, "", err
+	}
+	return acc, newCh().URL(), nil
+}
+
+// ExportState returns the cookies and localStorage of the provider domain in the playwright storage state format
+func (s *Browser) ExportState(model, account string) ([]byte, error) {
+	acc, handlerURL, err := s.providerAccount(model, account)
+	if err != nil {
+		return nil, err
+	}
+	domain := providerDomain(handlerURL)
+	log := logger.With().Str("account", acc.name).Str("domain", domain).Logger()
+
+	// localStorage is only collected from the origins open in the context
+	page, err := acc.openPage()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = page.Close() }()
+	if _, err = page.Goto(handlerURL, playwright.PageGotoOptions{Timeout: playwright.Float(30 * 1000)}); err != nil {
+		log.Error().Err(err).Msg("state page goto error")
+		return nil, err
+	}
+
+	state, err := acc.bc.StorageState()
+	if err != nil {
+		log.Error().Err(err).Msg("get storage state error")
+		return nil, err
+	}
+	out := &playwright.StorageState{Cookies: []playwright.Cookie{}, Origins: []playwright.Origin{}}
+	for _, c := range state.Cookies {
+		if matchDomain(c.Domain, domain) {
+			out.Cookies = append(out.Cookies, c)
+		}
+	}
+	for _, o := range state.Origins {
+		if matchOrigin(o.Origin, domain) {
+			out.Origins = append(out.Origins, o)
+		}
+	}
+	log.Info().Msgf("export %d cookies and %d origins", len(out.Cookies), len(out.Origins))
+	return json.Marshal(out)
+}
+
+// ImportState adds the cookies and localStorage of the provider domain from a playwright storage state,
+// entries of other domains are ignored
+func (s *Browser) ImportState(ctx context.Context, model, account string, bs []byte) error {
+	acc, handlerURL, err := s.providerAccount(model, account)
+	if err != nil {
+		return err
+	}
+	domain := providerDomain(handlerURL)
+	log := logger.With().Str("account", acc.name).Str("domain", domain).Logger()
+
+	state, err := json.UnmarshalTo[*playwright.StorageState](bs)
+	if err != nil || state == nil {
+		return errx.BadRequest().WithMsgf("invalid storage state: %v", err)
+	}
+
+	var cookies []playwright.OptionalCookie
+	for _, c := range state.Cookies {
+		if !matchDomain(c.Domain, domain) {
+			continue
+		}
+		cookies = append(cookies, playwright.OptionalCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   playwright.String(c.Domain),
+			Path:     playwright.String(c.Path),
+			Expires:  playwright.Float(c.Expires),
+			HttpOnly: playwright.Bool(c.HttpOnly),
+			Secure:   playwright.Bool(c.Secure),
+			SameSite: c.SameSite,
+		})
+	}
+	if len(cookies) > 0 {
+		if err = acc.bc.AddCookies(cookies); err != nil {
+			log.Error().Err(err).Msg("add cookies error")
+			return err
+		}
+	}
+
+	origins := 0
+	for _, o := range state.Origins {
+		if !matchOrigin(o.Origin, domain) || len(o.LocalStorage) == 0 {
+			continue
+		}
+		if err = acc.setLocalStorage(o); err != nil {
+			log.Error().Err(err).Str("origin", o.Origin).Msg("set local storage error")
+			return err
+		}
+		origins++
+	}
+	log.Info().Msgf("import %d cookies and %d origins", len(cookies), origins)
+
+	name, _ := splitModel(model)
+	acc.pools[name].check(ctx)
+	return nil
+}
+
+// setLocalStorage has no playwright api for an existing context, so the items are set from a page of the origin
+func (s *account) setLocalStorage(o playwright.Origin) error {
+	page, err := s.openPage()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = page.Close() }()
+	if _, err = page.Goto(o.Origin, playwright.PageGotoOptions{Timeout: playwright.Float(30 * 1000)}); err != nil {
+		return err
+	}
+	_, err = page.Evaluate(`items => { for (const { name, value } of items) localStorage.setItem(name, value) }`, o.LocalStorage)
+	return err
+}
@@ -0,0 +1,19 @@
+package browser
+
+import (
+	"testing"
+)
+
+func TestProviderDomain(t *testing.T) {
+	for _, name := range handlerNames() {
+		url := chatHandlers[name]().URL()
+		domain := providerDomain(url)
+		t.Logf("%s: %s -> %s", name, url, domain)
+		if domain == "" || !matchOrigin(url, domain) {
+			t.Errorf("unexpected domain %q of %s", domain, url)
+		}
+	}
+	if !matchDomain(".qwen.ai", "qwen.ai") || !matchDomain("chat.qwen.ai", "qwen.ai") || matchDomain("notqwen.ai", "qwen.ai") {
+		t.Error("unexpected matchDomain result")
+	}
+}
@@ -0,0 +1,224 @@
+package browser
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"github.com/starudream/aichat-proxy/server/config"
+	"github.com/starudream/aichat-proxy/server/logger"
+)
+
+const (
+	StateUnknown   = "unknown"
+	StateReady     = "ready"
+	StateLoggedOut = "logged_out"
+	StateCaptcha   = "captcha"
+	StateBusy      = "busy"
+	StateError     = "error"
+)
+
+// chatChecker is implemented by handlers that can tell from their page whether the site is usable,
+// it returns one of StateReady, StateLoggedOut and StateCaptcha
+type chatChecker interface {
+	Check() (string, error)
+}
+
+const captchaSelector = `iframe[src*="captcha"], iframe[src*="challenges.cloudflare.com"], [id*="captcha" i], [class*="captcha" i]`
+
+// checkPage tells the state of the page from the auth urls it may be redirected to,
+// and which of the chat input, the login entry or a captcha shows up first
+func checkPage(page playwright.Page, ready, login playwright.Locator, authURLs ...string) (string, error) {
+	url := page.URL()
+	for _, v := range authURLs {
+		if strings.Contains(url, v) {
+			return StateLoggedOut, nil
+		}
+	}
+	locCaptcha := page.Locator(captchaSelector).First()
+	if err := ready.Or(login).Or(locCaptcha).First().WaitFor(playwright.LocatorWaitForOptions{Timeout: playwright.Float(10 * 1000)}); err != nil {
+		return StateError, err
+	}
+	if v, _ := locCaptcha.IsVisible(); v {
+		return StateCaptcha, nil
+	}
+	if v, _ := login.First().IsVisible(); v {
+		return StateLoggedOut, nil
+	}
+	return StateReady, nil
+}
+
+// poolStatus is the last known state of one handler in one account
+type poolStatus struct {
+	mu sync.Mutex
+
+	state       string
+	err         string
+	checkedAt   time.Time
+	lastSuccess time.Time
+}
+
+// set records the state, and reports whether it differs from the previous one
+func (s *poolStatus) set(state string, err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.state != state
+	s.state, s.err, s.checkedAt = state, "", time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	return changed
+}
+
+// captchaBlockTTL is how long a pool stays blocked after a captcha is seen, unless a check or an answer says otherwise
+const captchaBlockTTL = 5 * time.Minute
+
+// blocked reports whether the pool was stopped by a captcha recently, requests to it fail fast meanwhile
+func (s *poolStatus) blocked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == StateCaptcha && time.Since(s.checkedAt) < captchaBlockTTL
+}
+
+func (s *poolStatus) succeed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.err, s.checkedAt, s.lastSuccess = StateReady, "", time.Now(), time.Now()
+}
+
+type ProviderStatus struct {
+	Name  string
+	State string
+	// LastSuccess is the latest answer among all accounts
+	LastSuccess time.Time
+	Accounts    []*AccountStatus
+}
+
+type AccountStatus struct {
+	Account     string
+	State       string
+	Error       string
+	CheckedAt   time.Time
+	LastSuccess time.Time
+}
+
+// statePriority orders the states from the most usable, the provider takes the best state of its accounts
+var statePriority = []string{StateReady, StateBusy, StateUnknown, StateCaptcha, StateLoggedOut, StateError}
+
+// Providers returns the status of every handler, a pool with all pages in use is reported as busy
+func (s *Browser) Providers() (ps []*ProviderStatus) {
+	if s == nil {
+		return nil
+	}
+	for _, name := range handlerNames() {
+		p := &ProviderStatus{Name: name, State: StateError}
+		for _, acc := range s.accounts {
+			pool := acc.pools[name]
+			pool.status.mu.Lock()
+			as := &AccountStatus{
+				Account:     acc.name,
+				State:       pool.status.state,
+				Error:       pool.status.err,
+				CheckedAt:   pool.status.checkedAt,
+				LastSuccess: pool.status.lastSuccess,
+			}
+			pool.status.mu.Unlock()
+			if as.State == "" {
+				as.State = StateUnknown
+			}
+			if as.State == StateReady && pool.busy() >= pool.size {
+				as.State = StateBusy
+			}
+			if slices.Index(statePriority, as.State) < slices.Index(statePriority, p.State) {
+				p.State = as.State
+			}
+			if as.LastSuccess.After(p.LastSuccess) {
+				p.LastSuccess = as.LastSuccess
+			}
+			p.Accounts = append(p.Accounts, as)
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// Usable reports whether any account may answer the model, a state not known yet counts as usable
+func (s *Browser) Usable(model string) bool {
+	if s == nil {
+		return true
+	}
+	name, _ := splitModel(model)
+	for _, p := range s.Providers() {
+		if p.Name == name {
+			return p.State == StateReady || p.State == StateBusy || p.State == StateUnknown
+		}
+	}
+	return false
+}
+
+// checkLoop probes every handler once at start and then at the configured interval
+func (s *Browser) checkLoop(ctx context.Context) {
+	interval := config.G().BrowserCheckInterval
+	if interval <= 0 {
+		return
+	}
+	for {
+		s.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *Browser) checkAll(ctx context.Context) {
+	for _, acc := range s.accounts {
+		for _, name := range handlerNames() {
+			if ctx.Err() != nil {
+				return
+			}
+			acc.pools[name].check(ctx)
+		}
+	}
+}
+
+// check opens the handler page and asks the handler for its state, it is skipped while the pool is fully in use
+func (p *pagePool) check(ctx context.Context) {
+	ch, ok := chatHandlers[p.name]().(chatChecker)
+	if !ok || p.busy() >= p.size {
+		return
+	}
+	log := logger.With().Str("model", p.name).Str("account", p.acc.name).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	page, err := p.acquire(ctx, "", PriorityLow, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("acquire page for check error")
+		p.status.set(StateError, err)
+		return
+	}
+	defer p.release(page)
+
+	p.checkPage(log, ch, page)
+}
+
+// checkPage records the state told by the handler, the operator is alerted when a captcha shows up
+func (p *pagePool) checkPage(log logger.ZLogger, ch chatChecker, page playwright.Page) string {
+	ch.(chatHandler).Setup(HandleChatOptions{log: log, page: page})
+	state, err := ch.Check()
+	if err != nil {
+		log.Error().Err(err).Msg("check page error")
+	} else if state != StateReady {
+		log.Warn().Msgf("check page state %s", state)
+	}
+	if p.status.set(state, err) && state == StateCaptcha {
+		p.alertCaptcha(log, page)
+	}
+	return state
+}
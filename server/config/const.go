@@ -11,7 +11,10 @@ const (
 
 	AppRootPath   = "/app"
 	UserdataPath  = AppRootPath + "/userdata"
-	Userdata0Path = UserdataPath + "/user0"
 	DownloadsPath = AppRootPath + "/downloads"
 	CertsPath     = AppRootPath + "/certs"
+	DebugPath     = AppRootPath + "/debug"
+	RecordPath    = AppRootPath + "/record"
+
+	SelectorsPath = AppRootPath + "/selectors.json"
 )
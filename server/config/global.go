@@ -1,12 +1,63 @@
 package config
 
+import (
+	"time"
+)
+
 type Config struct {
 	LogLevel   string `config:"log.level"`
 	LogNoColor bool   `config:"log.nocolor"`
 
 	ServerAddr string `config:"server.addr"`
 
-	ApiKeys Array[string] `config:"api.keys"`
+	ApiKeys        Array[string] `config:"api.keys"`
+	ApiKeyAccounts Map[string]   `config:"api.key.accounts"`
+	// key:class, the class is high, normal or low, a higher class is served first when the requests wait for a page
+	ApiKeyPriorities Map[string] `config:"api.key.priorities"`
+	// download the http image urls of the messages, only public addresses are dialed, images are only taken as data urls when off
+	ApiImageFetch bool `config:"api.image.fetch"`
+	// keys of the admin api, the admin api is disabled when empty
+	AdminKeys Array[string] `config:"admin.keys"`
+	// passphrase to encrypt the exported storage states, they are exported in plain text when empty
+	AdminStatePassphrase string `config:"admin.state.passphrase"`
+
+	// alias:target, the target is one or more models separated by | with optional query like ?thinking=enabled&search=enabled
+	ModelAliases Map[string] `config:"model.aliases"`
+	// model:fallbacks, the fallbacks are models separated by | tried in order when the model fails before answering
+	ModelFallbacks Map[string] `config:"model.fallbacks"`
+	// hide the models whose provider is logged out, blocked by captcha or failing from /v1/models
+	ModelHideUnusable bool `config:"model.hide.unusable"`
+
+	BrowserAccounts   Array[string] `config:"browser.accounts"`
+	BrowserPoolSize   int           `config:"browser.pool.size"`
+	BrowserPoolModels Map[int]      `config:"browser.pool.models"`
+	// requests waiting for a page of a provider in one account, more are refused with 429, 0 means no limit
+	BrowserQueueSize   int      `config:"browser.queue.size"`
+	BrowserQueueModels Map[int] `config:"browser.queue.models"`
+	// longest wait for a page before 429, 0 waits until the client gives up
+	BrowserQueueTimeout time.Duration `config:"browser.queue.timeout"`
+	// interval of the sse comments sent to the streaming clients while they wait
+	BrowserQueueKeepalive time.Duration `config:"browser.queue.keepalive"`
+	// interval to probe the login state of every provider, 0 disables the probe
+	BrowserCheckInterval time.Duration `config:"browser.check.interval"`
+	// web search state of the handlers with a search switch when the request does not set one, auto leaves the page as is
+	BrowserSearch string `config:"browser.search"`
+	// json file overriding the built-in selectors and steps of the handlers, reloaded when changed
+	BrowserSelectors string `config:"browser.selectors"`
+
+	// url to post alerts to, such as a captcha that needs a human, alerts are only logged when empty
+	AlertWebhook string `config:"alert.webhook"`
+
+	// save a screenshot and the html of the page when a handler fails, for selectors broken by a site redesign
+	DebugCapture bool `config:"debug.capture"`
+	// also save a playwright trace of the failed chat, it slows the browser down a little
+	DebugTrace bool `config:"debug.trace"`
+	// captures older than this are removed, 0 keeps them forever
+	DebugMaxAge time.Duration `config:"debug.max.age"`
+	// the oldest captures are removed when all of them take more megabytes than this, 0 means no limit
+	DebugMaxSize int64 `config:"debug.max.size"`
+	// save the intercepted streams as they are parsed, to be replayed by the tests of the handlers
+	DebugRecord bool `config:"debug.record"`
 }
 
 var g = &Config{
@@ -14,6 +65,19 @@ var g = &Config{
 	LogNoColor: false,
 
 	ServerAddr: ServerAddress,
+
+	BrowserAccounts:       Array[string]{"user0"},
+	BrowserPoolSize:       1,
+	BrowserQueueSize:      16,
+	BrowserQueueTimeout:   2 * time.Minute,
+	BrowserQueueKeepalive: 10 * time.Second,
+	BrowserCheckInterval:  10 * time.Minute,
+	BrowserSearch:         "disabled",
+	BrowserSelectors:      SelectorsPath,
+
+	DebugCapture: true,
+	DebugMaxAge:  72 * time.Hour,
+	DebugMaxSize: 256,
 }
 
 func G() *Config {
@@ -18,3 +18,15 @@ func (vs *Array[T]) UnmarshalText(bs []byte) error {
 	}
 	return nil
 }
+
+type Map[T cast.Basic] map[string]T
+
+func (vs *Map[T]) UnmarshalText(bs []byte) error {
+	ss := strings.FieldsFunc(conv.BytesToString(bs), func(r rune) bool { return r == ',' })
+	*vs = make(map[string]T, len(ss))
+	for _, s := range ss {
+		k, v, _ := strings.Cut(s, ":")
+		(*vs)[strings.TrimSpace(k)] = cast.To[T](strings.TrimSpace(v))
+	}
+	return nil
+}
@@ -44,30 +44,152 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/chat/completions": {
+        "/admin/debug": {
+            "get": {
+                "description": "Screenshots, html and traces saved when a chat fails to input, send or times out",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Debug Capture List",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListDebugCaptureResp"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/debug/{id}/{file}": {
+            "get": {
+                "description": "Download a file of a debug capture, open the trace.zip with https://trace.playwright.dev",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Debug Capture File",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Capture Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File Name",
+                        "name": "file",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/logins": {
             "post": {
+                "description": "Open the login page of the provider in a dedicated tab, the tab is closed after 10 minutes",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Start Login",
+                "parameters": [
+                    {
+                        "description": "Request",
+                        "name": "*",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.LoginReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.Login"
+                        }
+                    }
+                },
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
+                ]
+            }
+        },
+        "/admin/logins/{id}": {
+            "delete": {
+                "description": "Close the login tab and check the provider again",
+                "tags": [
+                    "admin"
                 ],
-                "description": "Follows the exact same API spec as ` + "`" + `https://platform.openai.com/docs/api-reference/chat` + "`" + `",
-                "produces": [
-                    "application/json",
-                    "text/event-stream"
+                "summary": "Finish Login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Login Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.Provider"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/logins/{id}/actions": {
+            "post": {
+                "description": "Fill the phone number or SMS code, click or press a key in the login page",
                 "tags": [
-                    "chat"
+                    "admin"
                 ],
-                "summary": "Chat Completions",
+                "summary": "Login Action",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Login Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "description": "Request",
                         "name": "*",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.ChatCompletionReq"
+                            "$ref": "#/definitions/api.LoginActionReq"
                         }
                     }
                 ],
@@ -75,97 +197,1339 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.ChatCompletionResp"
+                            "$ref": "#/definitions/api.Login"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
             }
         },
-        "/v1/models": {
+        "/admin/logins/{id}/qrcode": {
             "get": {
+                "description": "The QR code to scan for providers like doubao and yuanbao, the login dialog is opened when needed",
+                "produces": [
+                    "image/png"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Login QR Code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Login Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                },
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
+                ]
+            }
+        },
+        "/admin/logins/{id}/screenshot": {
+            "get": {
+                "produces": [
+                    "image/jpeg"
                 ],
-                "description": "Follows the exact same API spec as ` + "`" + `https://platform.openai.com/docs/api-reference/models/list` + "`" + `",
                 "tags": [
-                    "model"
+                    "admin"
                 ],
-                "summary": "Model List",
+                "summary": "Login Screenshot",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Login Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/logins/{id}/stream": {
+            "get": {
+                "description": "Live screenshots of the login page as a MJPEG stream, usable as the src of an img",
+                "produces": [
+                    "multipart/x-mixed-replace"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Login Stream",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Login Id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/queues": {
+            "get": {
+                "description": "Pages in use and requests waiting for a page of every provider in every account",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Queue List",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.ListModelResp"
+                            "$ref": "#/definitions/api.ListQueueResp"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
             }
-        }
-    },
-    "definitions": {
-        "api.ChatCompletionChoice": {
-            "type": "object",
-            "properties": {
-                "delta": {
-                    "description": "模型输出的增量内容（流式）",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatCompletionMessage"
+        },
+        "/admin/selectors": {
+            "get": {
+                "description": "The selectors and steps of every handler in use, the built-in ones merged with the override file, which is reloaded when changed",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Selectors",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
                         }
-                    ]
+                    }
                 },
-                "finish_reason": {
-                    "description": "模型停止输出原因",
-                    "type": "string"
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/states/{model}": {
+            "get": {
+                "description": "Cookies and localStorage of the provider domain in the playwright storage state format, encrypted when a passphrase is configured",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Export State",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Model Id",
+                        "name": "model",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account, the first one when empty",
+                        "name": "account",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
                 },
-                "index": {
-                    "description": "消息索引",
-                    "type": "integer"
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "put": {
+                "description": "Add the cookies and localStorage of the provider domain from an exported storage state, encrypted or not",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Import State",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Model Id",
+                        "name": "model",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account, the first one when empty",
+                        "name": "account",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Storage State",
+                        "name": "*",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.Provider"
+                        }
+                    }
                 },
-                "message": {
-                    "description": "模型输出消息列表（非流式）",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatCompletionMessage"
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/chat/completions": {
+            "post": {
+                "description": "Follows the exact same API spec as ` + "`" + `https://platform.openai.com/docs/api-reference/chat` + "`" + `",
+                "produces": [
+                    "application/json",
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "chat"
+                ],
+                "summary": "Chat Completions",
+                "parameters": [
+                    {
+                        "description": "Request",
+                        "name": "*",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ChatCompletionReq"
                         }
-                    ]
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ChatCompletionResp"
+                        },
+                        "headers": {
+                            "X-Aichat-Proxy-Model": {
+                                "type": "string",
+                                "description": "model that actually answered, sent as the sse comment ': model \u003cid\u003e' when the stream opened while queued"
+                            }
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/messages": {
+            "post": {
+                "description": "Follows the exact same API spec as ` + "`" + `https://docs.anthropic.com/en/api/messages` + "`" + `",
+                "produces": [
+                    "application/json",
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "chat"
+                ],
+                "summary": "Messages",
+                "parameters": [
+                    {
+                        "description": "Request",
+                        "name": "*",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.MessageReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.MessageResp"
+                        },
+                        "headers": {
+                            "X-Aichat-Proxy-Model": {
+                                "type": "string",
+                                "description": "model that actually answered, sent as the sse comment ': model \u003cid\u003e' when the stream opened while queued"
+                            }
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/models": {
+            "get": {
+                "description": "Follows the exact same API spec as ` + "`" + `https://platform.openai.com/docs/api-reference/models/list` + "`" + `",
+                "tags": [
+                    "model"
+                ],
+                "summary": "Model List",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListModelResp"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/providers": {
+            "get": {
+                "description": "Login and health state of every provider, probed periodically and updated by every chat",
+                "tags": [
+                    "model"
+                ],
+                "summary": "Provider List",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListProviderResp"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/responses": {
+            "post": {
+                "description": "Follows the exact same API spec as ` + "`" + `https://platform.openai.com/docs/api-reference/responses` + "`" + `",
+                "produces": [
+                    "application/json",
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "chat"
+                ],
+                "summary": "Responses",
+                "parameters": [
+                    {
+                        "description": "Request",
+                        "name": "*",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ResponseResp"
+                        },
+                        "headers": {
+                            "X-Aichat-Proxy-Model": {
+                                "type": "string",
+                                "description": "model that actually answered, sent as the sse comment ': model \u003cid\u003e' when the stream opened while queued"
+                            }
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        }
+    },
+    "definitions": {
+        "api.ChatCompletionAnnotation": {
+            "type": "object",
+            "properties": {
+                "type": {
+                    "description": "类型，固定为 url_citation",
+                    "type": "string"
+                },
+                "url_citation": {
+                    "description": "网页引用",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionURLCitation"
+                        }
+                    ]
+                }
+            }
+        },
+        "api.ChatCompletionChoice": {
+            "type": "object",
+            "properties": {
+                "delta": {
+                    "description": "模型输出的增量内容（流式）",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionMessage"
+                        }
+                    ]
+                },
+                "finish_reason": {
+                    "description": "模型停止输出原因",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "消息索引",
+                    "type": "integer"
+                },
+                "message": {
+                    "description": "模型输出消息列表（非流式）",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionMessage"
+                        }
+                    ]
+                }
+            }
+        },
+        "api.ChatCompletionMessage": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "annotations": {
+                    "description": "引用来源（仅响应）",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionAnnotation"
+                    }
+                },
+                "content": {
+                    "description": "内容",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionMessageContent"
+                        }
+                    ]
+                },
+                "reasoning_content": {
+                    "description": "推理内容（仅响应）",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色",
+                    "type": "string"
+                },
+                "tool_call_id": {
+                    "description": "工具调用 Id（仅 tool 角色）",
+                    "type": "string"
+                },
+                "tool_calls": {
+                    "description": "工具调用",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionToolCall"
+                    }
+                }
+            }
+        },
+        "api.ChatCompletionMessageContent": {
+            "type": "object",
+            "properties": {
+                "listValue": {
+                    "description": "数组",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionMessageContentPart"
+                    }
+                },
+                "stringValue": {
+                    "description": "文本",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionMessageContentPart": {
+            "type": "object",
+            "properties": {
+                "image_url": {
+                    "description": "图片",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatMessageImageURL"
+                        }
+                    ]
+                },
+                "text": {
+                    "description": "文本",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，可选 text、image_url",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionReq": {
+            "type": "object",
+            "required": [
+                "model"
+            ],
+            "properties": {
+                "messages": {
+                    "description": "消息列表",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionMessage"
+                    }
+                },
+                "model": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "search": {
+                    "description": "联网搜索，可选 auto、enabled、disabled，优先于 web_search_options，auto 保持页面当前状态，默认使用 BROWSER_SEARCH 配置（默认 disabled）",
+                    "type": "string"
+                },
+                "session": {
+                    "description": "会话模式，历史消息与之前的对话一致时，继续该对话并仅发送新的消息",
+                    "type": "boolean"
+                },
+                "stream": {
+                    "description": "是否流式",
+                    "type": "boolean"
+                },
+                "thinking": {
+                    "description": "推理配置",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionThinking"
+                        }
+                    ]
+                },
+                "tools": {
+                    "description": "工具",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionTool"
+                    }
+                },
+                "web_search_options": {
+                    "description": "联网搜索配置，存在时开启联网搜索",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionWebSearchOptions"
+                        }
+                    ]
+                }
+            }
+        },
+        "api.ChatCompletionResp": {
+            "type": "object",
+            "properties": {
+                "choices": {
+                    "description": "模型输出内容",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChatCompletionChoice"
+                    }
+                },
+                "created": {
+                    "description": "请求创建的时间戳（秒级）",
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "请求的唯一标识",
+                    "type": "string"
+                },
+                "model": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "object": {
+                    "description": "响应类型",
+                    "type": "string"
+                },
+                "usage": {
+                    "description": "用量",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionUsage"
+                        }
+                    ]
+                }
+            }
+        },
+        "api.ChatCompletionThinking": {
+            "type": "object",
+            "properties": {
+                "type": {
+                    "description": "auto：自动思考模式\nenabled：开启思考模式\ndisabled：关闭思考模式",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionTokens": {
+            "type": "object",
+            "properties": {
+                "reasoning_tokens": {
+                    "description": "思维链 tokens",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ChatCompletionTool": {
+            "type": "object",
+            "properties": {
+                "function": {
+                    "description": "工具定义",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionToolFunction"
+                        }
+                    ]
+                },
+                "type": {
+                    "description": "类型，可选 function",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionToolCall": {
+            "type": "object",
+            "properties": {
+                "function": {
+                    "description": "函数调用",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionToolCallFunction"
+                        }
+                    ]
+                },
+                "id": {
+                    "description": "工具调用 Id",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "索引（仅流式）",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "类型，固定为 function",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionToolCallFunction": {
+            "type": "object",
+            "properties": {
+                "arguments": {
+                    "description": "参数，JSON 字符串",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "函数名称",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionToolFunction": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "描述",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "名称",
+                    "type": "string"
+                },
+                "parameters": {
+                    "description": "参数列表"
+                }
+            }
+        },
+        "api.ChatCompletionURLCitation": {
+            "type": "object",
+            "properties": {
+                "end_index": {
+                    "description": "引用在内容中的结束位置，网页端不提供，固定为 0",
+                    "type": "integer"
+                },
+                "start_index": {
+                    "description": "引用在内容中的起始位置，网页端不提供，固定为 0",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "标题",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "链接",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatCompletionUsage": {
+            "type": "object",
+            "properties": {
+                "completion_tokens": {
+                    "description": "输出 tokens",
+                    "type": "integer"
+                },
+                "completion_tokens_details": {
+                    "description": "输出 tokens",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ChatCompletionTokens"
+                        }
+                    ]
+                },
+                "prompt_tokens": {
+                    "description": "输入 tokens",
+                    "type": "integer"
+                },
+                "total_tokens": {
+                    "description": "总消耗 tokens",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ChatCompletionWebSearchOptions": {
+            "type": "object",
+            "properties": {
+                "search_context_size": {
+                    "description": "搜索上下文大小，仅做兼容",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ChatMessageImageURL": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "description": "图片的质量，可选 high、low、auto",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "图片的 Base64 data url，或图片链接（需开启 API_IMAGE_FETCH，仅限公网地址）",
+                    "type": "string"
+                }
+            }
+        },
+        "api.DebugCapture": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "保存时间戳",
+                    "type": "integer"
+                },
+                "files": {
+                    "description": "文件列表，可能包含 screenshot.png、page.html、trace.zip、error.txt",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "现场 Id，即会话的 handlerId",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "总大小，单位字节",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Index": {
+            "type": "object",
+            "properties": {
+                "app_name": {
+                    "type": "string"
+                },
+                "build_date": {
+                    "type": "string"
+                },
+                "git_version": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ListDebugCaptureResp": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "现场列表，按时间倒序",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.DebugCapture"
+                    }
+                },
+                "object": {
+                    "description": "固定为 list",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ListModelResp": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "模型列表",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.Model"
+                    }
+                },
+                "object": {
+                    "description": "固定为 list",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ListProviderResp": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "提供方列表",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.Provider"
+                    }
+                },
+                "object": {
+                    "description": "固定为 list",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ListQueueResp": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "各提供方各账号的队列",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.Queue"
+                    }
+                },
+                "object": {
+                    "description": "固定为 list",
+                    "type": "string"
+                }
+            }
+        },
+        "api.Login": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "description": "账号",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "登录会话 Id",
+                    "type": "string"
+                },
+                "model": {
+                    "description": "提供方 Id",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "页面当前地址",
+                    "type": "string"
+                }
+            }
+        },
+        "api.LoginActionReq": {
+            "type": "object",
+            "required": [
+                "type"
+            ],
+            "properties": {
+                "selector": {
+                    "description": "playwright 选择器",
+                    "type": "string"
+                },
+                "text": {
+                    "description": "文本",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，可选 fill、click、press、phone、code\nfill：向 selector 对应的输入框填写 text\nclick：点击 selector 对应的元素，或文本等于 text 的元素，或坐标 x、y\npress：按下 text 对应的按键，如 Enter\nphone、code：向手机号、验证码输入框填写 text，selector 可覆盖默认的输入框",
+                    "type": "string"
+                },
+                "x": {
+                    "description": "横坐标，对应截图中的像素",
+                    "type": "number"
+                },
+                "y": {
+                    "description": "纵坐标，对应截图中的像素",
+                    "type": "number"
+                }
+            }
+        },
+        "api.LoginReq": {
+            "type": "object",
+            "required": [
+                "model"
+            ],
+            "properties": {
+                "account": {
+                    "description": "账号，为空时使用第一个账号",
+                    "type": "string"
+                },
+                "model": {
+                    "description": "模型 Id，变体会被忽略",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageContent": {
+            "type": "object",
+            "properties": {
+                "listValue": {
+                    "description": "数组",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.MessageContentBlock"
+                    }
+                },
+                "stringValue": {
+                    "description": "文本",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageContentBlock": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "工具结果（tool_result）",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageContent"
+                        }
+                    ]
+                },
+                "id": {
+                    "description": "工具调用 Id（tool_use）",
+                    "type": "string"
+                },
+                "input": {
+                    "description": "工具参数（tool_use）"
+                },
+                "name": {
+                    "description": "工具名称（tool_use）",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "推理签名（thinking）",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "图片",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageImageSource"
+                        }
+                    ]
+                },
+                "text": {
+                    "description": "文本",
+                    "type": "string"
+                },
+                "thinking": {
+                    "description": "推理内容（thinking）",
+                    "type": "string"
+                },
+                "tool_use_id": {
+                    "description": "工具调用 Id（tool_result）",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，可选 text、image、tool_use、tool_result、thinking",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageImageSource": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "Base64 编码的数据",
+                    "type": "string"
+                },
+                "media_type": {
+                    "description": "媒体类型，如 image/png",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，可选 base64、url",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "图片链接",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageParam": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "content": {
+                    "description": "内容",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageContent"
+                        }
+                    ]
+                },
+                "role": {
+                    "description": "角色，可选 user、assistant",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageReq": {
+            "type": "object",
+            "required": [
+                "model"
+            ],
+            "properties": {
+                "max_tokens": {
+                    "description": "最大输出 tokens，仅做兼容",
+                    "type": "integer"
+                },
+                "messages": {
+                    "description": "消息列表",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.MessageParam"
+                    }
+                },
+                "model": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "stream": {
+                    "description": "是否流式",
+                    "type": "boolean"
+                },
+                "system": {
+                    "description": "系统提示词",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageContent"
+                        }
+                    ]
+                },
+                "thinking": {
+                    "description": "推理配置",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageThinking"
+                        }
+                    ]
+                },
+                "tools": {
+                    "description": "工具",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.MessageTool"
+                    }
+                }
+            }
+        },
+        "api.MessageResp": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "内容",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.MessageContentBlock"
+                    }
+                },
+                "id": {
+                    "description": "消息 Id",
+                    "type": "string"
+                },
+                "model": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "固定为 assistant",
+                    "type": "string"
+                },
+                "stop_reason": {
+                    "description": "停止原因，可选 end_turn、max_tokens、tool_use、refusal",
+                    "type": "string"
+                },
+                "stop_sequence": {
+                    "description": "停止序列",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "固定为 message",
+                    "type": "string"
+                },
+                "usage": {
+                    "description": "用量",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.MessageUsage"
+                        }
+                    ]
+                }
+            }
+        },
+        "api.MessageThinking": {
+            "type": "object",
+            "properties": {
+                "budget_tokens": {
+                    "description": "思考预算 tokens，仅做兼容",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "enabled：开启思考模式\ndisabled：关闭思考模式",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageTool": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "描述",
+                    "type": "string"
+                },
+                "input_schema": {
+                    "description": "参数列表"
+                },
+                "name": {
+                    "description": "名称",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，自定义工具为空，web_search_20250305 表示开启联网搜索",
+                    "type": "string"
+                }
+            }
+        },
+        "api.MessageUsage": {
+            "type": "object",
+            "properties": {
+                "input_tokens": {
+                    "description": "输入 tokens",
+                    "type": "integer"
+                },
+                "output_tokens": {
+                    "description": "输出 tokens",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.Model": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "object": {
+                    "type": "string"
+                },
+                "owned_by": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.Provider": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "description": "各账号的状态",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ProviderAccount"
+                    }
+                },
+                "id": {
+                    "description": "提供方 Id，即不带变体的模型 Id",
+                    "type": "string"
+                },
+                "last_success_at": {
+                    "description": "最近一次成功回答的时间戳",
+                    "type": "integer"
+                },
+                "state": {
+                    "description": "状态，取所有账号中最可用的状态，可选 ready、logged_out、captcha、busy、error、unknown",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ProviderAccount": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "description": "账号",
+                    "type": "string"
+                },
+                "checked_at": {
+                    "description": "最近一次检查的时间戳",
+                    "type": "integer"
+                },
+                "error": {
+                    "description": "错误信息",
+                    "type": "string"
+                },
+                "last_success_at": {
+                    "description": "最近一次成功回答的时间戳",
+                    "type": "integer"
+                },
+                "state": {
+                    "description": "状态",
+                    "type": "string"
+                }
+            }
+        },
+        "api.Queue": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "description": "账号",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "提供方 Id",
+                    "type": "string"
+                },
+                "in_use": {
+                    "description": "使用中的页面数",
+                    "type": "integer"
+                },
+                "limit": {
+                    "description": "排队上限，0 表示不限制",
+                    "type": "integer"
+                },
+                "queued": {
+                    "description": "排队中的请求数",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "页面数",
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ResponseError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "错误码，可选 server_error、rate_limit_exceeded",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "错误信息",
+                    "type": "string"
+                }
+            }
+        },
+        "api.ResponseIncompleteDetails": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "description": "原因，可选 max_output_tokens、content_filter",
+                    "type": "string"
                 }
             }
         },
-        "api.ChatCompletionMessage": {
+        "api.ResponseInput": {
             "type": "object",
-            "required": [
-                "role"
-            ],
             "properties": {
-                "content": {
-                    "description": "内容",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatCompletionMessageContent"
-                        }
-                    ]
-                },
-                "reasoning_content": {
-                    "description": "推理内容（仅响应）",
-                    "type": "string"
+                "listValue": {
+                    "description": "数组",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseInputItem"
+                    }
                 },
-                "role": {
-                    "description": "角色",
+                "stringValue": {
+                    "description": "文本",
                     "type": "string"
                 }
             }
         },
-        "api.ChatCompletionMessageContent": {
+        "api.ResponseInputContent": {
             "type": "object",
             "properties": {
                 "listValue": {
                     "description": "数组",
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/api.ChatCompletionMessageContentPart"
+                        "$ref": "#/definitions/api.ResponseInputContentPart"
                     }
                 },
                 "stringValue": {
@@ -174,111 +1538,126 @@ const docTemplate = `{
                 }
             }
         },
-        "api.ChatCompletionMessageContentPart": {
+        "api.ResponseInputContentPart": {
             "type": "object",
             "properties": {
                 "image_url": {
-                    "description": "图片",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatMessageImageURL"
-                        }
-                    ]
+                    "description": "图片链接或图片的 Base64 编码",
+                    "type": "string"
                 },
                 "text": {
                     "description": "文本",
                     "type": "string"
                 },
                 "type": {
-                    "description": "类型，可选 text、image_url",
+                    "description": "类型，可选 input_text、output_text、input_image",
                     "type": "string"
                 }
             }
         },
-        "api.ChatCompletionReq": {
+        "api.ResponseInputItem": {
             "type": "object",
-            "required": [
-                "model"
-            ],
             "properties": {
-                "messages": {
-                    "description": "消息列表",
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/api.ChatCompletionMessage"
-                    }
-                },
-                "model": {
-                    "description": "模型 Id",
+                "arguments": {
+                    "description": "工具参数，JSON 字符串（function_call）",
                     "type": "string"
                 },
-                "stream": {
-                    "description": "是否流式",
-                    "type": "boolean"
+                "call_id": {
+                    "description": "工具调用 Id（function_call、function_call_output）",
+                    "type": "string"
                 },
-                "thinking": {
-                    "description": "推理配置",
+                "content": {
+                    "description": "内容（message）",
                     "allOf": [
                         {
-                            "$ref": "#/definitions/api.ChatCompletionThinking"
+                            "$ref": "#/definitions/api.ResponseInputContent"
                         }
                     ]
                 },
-                "tools": {
-                    "description": "工具",
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/api.ChatCompletionTool"
-                    }
+                "name": {
+                    "description": "工具名称（function_call）",
+                    "type": "string"
+                },
+                "output": {
+                    "description": "工具结果（function_call_output）",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色，可选 system、developer、user、assistant（message）",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "类型，可选 message、function_call、function_call_output，为空时视为 message",
+                    "type": "string"
                 }
             }
         },
-        "api.ChatCompletionResp": {
+        "api.ResponseOutputItem": {
             "type": "object",
             "properties": {
-                "choices": {
-                    "description": "模型输出内容",
+                "arguments": {
+                    "description": "工具参数，JSON 字符串（function_call）",
+                    "type": "string"
+                },
+                "call_id": {
+                    "description": "工具调用 Id（function_call）",
+                    "type": "string"
+                },
+                "content": {
+                    "description": "内容（message）",
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/api.ChatCompletionChoice"
+                        "$ref": "#/definitions/api.ResponseOutputText"
                     }
                 },
-                "created": {
-                    "description": "请求创建的时间戳（秒级）",
-                    "type": "integer"
-                },
                 "id": {
-                    "description": "请求的唯一标识",
+                    "description": "输出项 Id",
                     "type": "string"
                 },
-                "model": {
-                    "description": "模型 Id",
+                "name": {
+                    "description": "工具名称（function_call）",
                     "type": "string"
                 },
-                "object": {
-                    "description": "响应类型",
+                "role": {
+                    "description": "角色（message）",
                     "type": "string"
                 },
-                "usage": {
-                    "description": "用量",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatCompletionUsage"
-                        }
-                    ]
+                "status": {
+                    "description": "状态，可选 in_progress、completed",
+                    "type": "string"
+                },
+                "summary": {
+                    "description": "推理摘要（reasoning）",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseSummaryText"
+                    }
+                },
+                "type": {
+                    "description": "类型，可选 reasoning、message、function_call",
+                    "type": "string"
                 }
             }
         },
-        "api.ChatCompletionThinking": {
+        "api.ResponseOutputText": {
             "type": "object",
             "properties": {
+                "annotations": {
+                    "description": "注释",
+                    "type": "array",
+                    "items": {}
+                },
+                "text": {
+                    "description": "文本",
+                    "type": "string"
+                },
                 "type": {
-                    "description": "auto：自动思考模式\nenabled：开启思考模式\ndisabled：关闭思考模式",
+                    "description": "固定为 output_text",
                     "type": "string"
                 }
             }
         },
-        "api.ChatCompletionTokens": {
+        "api.ResponseOutputTokens": {
             "type": "object",
             "properties": {
                 "reasoning_tokens": {
@@ -287,122 +1666,173 @@ const docTemplate = `{
                 }
             }
         },
-        "api.ChatCompletionTool": {
+        "api.ResponseReasoning": {
             "type": "object",
             "properties": {
-                "function": {
-                    "description": "工具定义",
-                    "allOf": [
-                        {
-                            "$ref": "#/definitions/api.ChatCompletionToolFunction"
-                        }
-                    ]
+                "effort": {
+                    "description": "推理强度，可选 minimal、low、medium、high，minimal 时关闭思考模式",
+                    "type": "string"
                 },
-                "type": {
-                    "description": "类型，可选 function",
+                "summary": {
+                    "description": "推理摘要，仅做兼容",
                     "type": "string"
                 }
             }
         },
-        "api.ChatCompletionToolFunction": {
+        "api.ResponseReq": {
             "type": "object",
+            "required": [
+                "model"
+            ],
             "properties": {
-                "description": {
-                    "description": "描述",
+                "input": {
+                    "description": "输入",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ResponseInput"
+                        }
+                    ]
+                },
+                "instructions": {
+                    "description": "系统提示词",
                     "type": "string"
                 },
-                "name": {
-                    "description": "名称",
+                "model": {
+                    "description": "模型 Id",
                     "type": "string"
                 },
-                "parameters": {
-                    "description": "参数列表"
+                "reasoning": {
+                    "description": "推理配置",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ResponseReasoning"
+                        }
+                    ]
+                },
+                "stream": {
+                    "description": "是否流式",
+                    "type": "boolean"
+                },
+                "tools": {
+                    "description": "工具",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseTool"
+                    }
                 }
             }
         },
-        "api.ChatCompletionUsage": {
+        "api.ResponseResp": {
             "type": "object",
             "properties": {
-                "completion_tokens": {
-                    "description": "输出 tokens",
+                "created_at": {
+                    "description": "创建的时间戳（秒级）",
                     "type": "integer"
                 },
-                "completion_tokens_details": {
-                    "description": "输出 tokens",
+                "error": {
+                    "description": "错误，仅 failed 时存在",
                     "allOf": [
                         {
-                            "$ref": "#/definitions/api.ChatCompletionTokens"
+                            "$ref": "#/definitions/api.ResponseError"
                         }
                     ]
                 },
-                "prompt_tokens": {
-                    "description": "输入 tokens",
-                    "type": "integer"
+                "id": {
+                    "description": "响应 Id",
+                    "type": "string"
                 },
-                "total_tokens": {
-                    "description": "总消耗 tokens",
-                    "type": "integer"
+                "incomplete_details": {
+                    "description": "未完成的原因，仅 incomplete 时存在",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ResponseIncompleteDetails"
+                        }
+                    ]
+                },
+                "model": {
+                    "description": "模型 Id",
+                    "type": "string"
+                },
+                "object": {
+                    "description": "固定为 response",
+                    "type": "string"
+                },
+                "output": {
+                    "description": "输出",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ResponseOutputItem"
+                    }
+                },
+                "status": {
+                    "description": "状态，可选 in_progress、completed、incomplete、failed",
+                    "type": "string"
+                },
+                "usage": {
+                    "description": "用量",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ResponseUsage"
+                        }
+                    ]
                 }
             }
         },
-        "api.ChatMessageImageURL": {
+        "api.ResponseSummaryText": {
             "type": "object",
             "properties": {
-                "detail": {
-                    "description": "图片的质量，可选 high、low、auto",
+                "text": {
+                    "description": "文本",
                     "type": "string"
                 },
-                "url": {
-                    "description": "图片链接或图片的 Base64 编码",
+                "type": {
+                    "description": "固定为 summary_text",
                     "type": "string"
                 }
             }
         },
-        "api.Index": {
+        "api.ResponseTool": {
             "type": "object",
             "properties": {
-                "app_name": {
+                "description": {
+                    "description": "描述",
                     "type": "string"
                 },
-                "build_date": {
+                "name": {
+                    "description": "名称",
                     "type": "string"
                 },
-                "git_version": {
-                    "type": "string"
-                }
-            }
-        },
-        "api.ListModelResp": {
-            "type": "object",
-            "properties": {
-                "data": {
-                    "description": "模型列表",
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/api.Model"
-                    }
+                "parameters": {
+                    "description": "参数列表"
                 },
-                "object": {
-                    "description": "固定为 list",
+                "type": {
+                    "description": "类型，可选 function、web_search、web_search_preview",
                     "type": "string"
                 }
             }
         },
-        "api.Model": {
+        "api.ResponseUsage": {
             "type": "object",
             "properties": {
-                "created": {
+                "input_tokens": {
+                    "description": "输入 tokens",
                     "type": "integer"
                 },
-                "id": {
-                    "description": "模型 Id",
-                    "type": "string"
+                "output_tokens": {
+                    "description": "输出 tokens",
+                    "type": "integer"
                 },
-                "object": {
-                    "type": "string"
+                "output_tokens_details": {
+                    "description": "输出 tokens",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.ResponseOutputTokens"
+                        }
+                    ]
                 },
-                "owned_by": {
-                    "type": "string"
+                "total_tokens": {
+                    "description": "总消耗 tokens",
+                    "type": "integer"
                 }
             }
         }
@@ -423,6 +1853,9 @@ const docTemplate = `{
         },
         {
             "name": "chat"
+        },
+        {
+            "name": "admin"
         }
     ]
 }`
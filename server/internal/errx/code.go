@@ -0,0 +1,17 @@
+package errx
+
+// Codes tell apart the errors sharing the same http status
+const (
+	// CodeCaptcha means the provider shows a captcha or human verification page, someone has to solve it over vnc
+	CodeCaptcha = 50301
+	// CodeServerBusy means the provider is overloaded and asks to retry later
+	CodeServerBusy = 50302
+	// CodeRateLimit means the provider limits the requests of the account
+	CodeRateLimit = 42901
+	// CodeQueueFull means too many requests are waiting for a page of the provider
+	CodeQueueFull = 42902
+	// CodeQueueTimeout means the request waited for a page longer than the queue timeout
+	CodeQueueTimeout = 42903
+	// CodeLoginExpired means the session of the account expired, someone has to log in again over vnc
+	CodeLoginExpired = 40101
+)
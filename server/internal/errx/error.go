@@ -76,3 +76,7 @@ func Forbidden() *Error    { return New(http.StatusForbidden) }
 func NotFound() *Error     { return New(http.StatusNotFound) }
 func Conflict() *Error     { return New(http.StatusConflict) }
 func Default() *Error      { return New(http.StatusInternalServerError) }
+
+func TooManyRequests() *Error    { return New(http.StatusTooManyRequests) }
+func ServiceUnavailable() *Error { return New(http.StatusServiceUnavailable) }
+func GatewayTimeout() *Error     { return New(http.StatusGatewayTimeout) }
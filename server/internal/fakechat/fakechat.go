@@ -0,0 +1,140 @@
+// Package fakechat is a minimal chat site for the end to end tests, it streams scripted answers as sse
+// so the whole chain can run without the real providers
+package fakechat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+// Host is the name the site is served under through the proxy, browsers do not proxy localhost
+const Host = "chat.fake.test"
+
+// Event is one sse message of an answer, Type is think, text or error
+type Event struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// Script returns the events to answer the prompt with
+type Script func(prompt string) []*Event
+
+// Echo thinks once and answers with the prompt word by word
+func Echo(prompt string) []*Event {
+	events := []*Event{{Type: "think", Content: "echo the prompt"}}
+	for i, word := range strings.Fields(prompt) {
+		if i > 0 {
+			word = " " + word
+		}
+		events = append(events, &Event{Type: "text", Content: word})
+	}
+	return events
+}
+
+type Server struct {
+	script Script
+	ln     net.Listener
+	srv    *http.Server
+	// served gets what Serve returned, nil once the server is closed
+	served chan error
+}
+
+// Start serves the site on a random local port, the script defaults to Echo
+func Start(script Script) (*Server, error) {
+	if script == nil {
+		script = Echo
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{script: script, ln: ln, served: make(chan error, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", s.hdrIndex)
+	mux.HandleFunc("POST /api/chat", s.hdrChat)
+	s.srv = &http.Server{Handler: mux}
+	go func() {
+		err := s.srv.Serve(ln)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		s.served <- err
+	}()
+	return s, nil
+}
+
+// Addr is the local address to dial for Host
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops the site, and returns the error the site stopped serving with before, if any
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	if serveErr := <-s.served; serveErr != nil {
+		return fmt.Errorf("fakechat: serve error: %w", serveErr)
+	}
+	return err
+}
+
+const indexHTML = `<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>fake chat</title></head>
+<body>
+<div id="messages"></div>
+<div id="chat">
+  <textarea id="prompt" placeholder="Send a message"></textarea>
+  <button id="send">Send</button>
+</div>
+<script>
+document.getElementById("send").addEventListener("click", async () => {
+  const prompt = document.getElementById("prompt").value;
+  document.getElementById("prompt").value = "";
+  const resp = await fetch("/api/chat", {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify({prompt})});
+  const reader = resp.body.getReader();
+  const out = document.createElement("p");
+  document.getElementById("messages").appendChild(out);
+  const decoder = new TextDecoder();
+  for (;;) {
+    const {done, value} = await reader.read();
+    if (done) break;
+    out.textContent += decoder.decode(value);
+  }
+});
+</script>
+</body>
+</html>
+`
+
+func (s *Server) hdrIndex(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(indexHTML))
+}
+
+func (s *Server) hdrChat(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Prompt string `json:"prompt"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for _, event := range s.script(req.Prompt) {
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", json.MustMarshal(event))
+		if flusher != nil {
+			flusher.Flush()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
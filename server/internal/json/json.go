@@ -19,6 +19,15 @@ var json = sonic.Config{
 	ValidateString:   true,
 }.Froze()
 
+// canonical sorts the map keys, for the text that is hashed or compared
+var canonical = sonic.Config{
+	EscapeHTML:       false,
+	SortMapKeys:      true,
+	CompactMarshaler: true,
+	CopyString:       true,
+	ValidateString:   true,
+}.Froze()
+
 var (
 	Marshal         = json.Marshal
 	MarshalToString = json.MarshalToString
@@ -52,6 +61,15 @@ func MustMarshalToString(v any) string {
 	return bs
 }
 
+// MustMarshalCanonical is MustMarshalToString with the map keys sorted, so the same value is always the same text
+func MustMarshalCanonical(v any) string {
+	bs, err := canonical.MarshalToString(v)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
 func UnmarshalTo[T any](v any) (t T, err error) {
 	switch x := v.(type) {
 	case string:
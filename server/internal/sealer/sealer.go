@@ -0,0 +1,95 @@
+package sealer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+const (
+	Algorithm = "aes-256-gcm+pbkdf2-sha256"
+
+	iterations = 600000
+
+	// an envelope outside this range is refused before deriving the key, a huge count would hang Open
+	minIterations = 100000
+	maxIterations = 10 * iterations
+)
+
+// Sealed is the json envelope of data encrypted with a passphrase
+type Sealed struct {
+	Algorithm  string `json:"algorithm"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// IsSealed reports whether bs is a Sealed envelope
+func IsSealed(bs []byte) bool {
+	v, err := json.UnmarshalTo[*Sealed](bs)
+	return err == nil && v != nil && v.Algorithm != ""
+}
+
+func Seal(plain []byte, passphrase string) ([]byte, error) {
+	sealed := &Sealed{Algorithm: Algorithm, Iterations: iterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(sealed.Salt); err != nil {
+		return nil, fmt.Errorf("sealer: read salt error: %w", err)
+	}
+	aead, err := newAEAD(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(sealed.Nonce); err != nil {
+		return nil, fmt.Errorf("sealer: read nonce error: %w", err)
+	}
+	sealed.Data = aead.Seal(nil, sealed.Nonce, plain, nil)
+	return json.Marshal(sealed)
+}
+
+func Open(bs []byte, passphrase string) ([]byte, error) {
+	sealed, err := json.UnmarshalTo[*Sealed](bs)
+	if err != nil {
+		return nil, fmt.Errorf("sealer: unmarshal error: %w", err)
+	}
+	if sealed.Algorithm != Algorithm {
+		return nil, fmt.Errorf("sealer: unsupported algorithm %q", sealed.Algorithm)
+	}
+	if sealed.Iterations < minIterations || sealed.Iterations > maxIterations {
+		return nil, fmt.Errorf("sealer: iterations %d out of range [%d, %d]", sealed.Iterations, minIterations, maxIterations)
+	}
+	aead, err := newAEAD(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, errors.New("sealer: invalid nonce")
+	}
+	plain, err := aead.Open(nil, sealed.Nonce, sealed.Data, nil)
+	if err != nil {
+		return nil, errors.New("sealer: wrong passphrase or corrupted data")
+	}
+	return plain, nil
+}
+
+func newAEAD(passphrase string, salt []byte, iter int) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("sealer: empty passphrase")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iter, 32)
+	if err != nil {
+		return nil, fmt.Errorf("sealer: derive key error: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("sealer: new cipher error: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
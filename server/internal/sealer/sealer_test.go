@@ -0,0 +1,39 @@
+package sealer
+
+import (
+	"testing"
+
+	"github.com/starudream/aichat-proxy/server/internal/json"
+)
+
+func TestSeal(t *testing.T) {
+	plain := []byte(`{"cookies":[],"origins":[]}`)
+	bs, err := Seal(plain, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(bs) || IsSealed(plain) {
+		t.Fatal("unexpected IsSealed result")
+	}
+	got, err := Open(bs, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(plain) {
+		t.Errorf("got %s, want %s", got, plain)
+	}
+	if _, err = Open(bs, "wrong"); err == nil {
+		t.Error("open with wrong passphrase should fail")
+	}
+
+	sealed, err := json.UnmarshalTo[*Sealed](bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, maxIterations + 1, 1 << 40} {
+		sealed.Iterations = n
+		if _, err = Open(json.MustMarshal(sealed), "secret"); err == nil {
+			t.Errorf("open with %d iterations should fail", n)
+		}
+	}
+}